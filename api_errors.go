@@ -0,0 +1,252 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+// The machine-readable codes of the errors that the ezbadminton API responds with
+const (
+	ErrorCodeInvalidRequest   = "INVALID_REQUEST"
+	ErrorCodeValidationFailed = "VALIDATION_FAILED"
+	ErrorCodeNotFound         = "NOT_FOUND"
+	ErrorCodeInternal         = "INTERNAL_ERROR"
+
+	ErrorCodeCompetitionNotFound       = "COMPETITION_NOT_FOUND"
+	ErrorCodeCompetitionAlreadyRunning = "COMPETITION_ALREADY_RUNNING"
+	ErrorCodeCompetitionAlreadyExists  = "COMPETITION_ALREADY_EXISTS"
+	ErrorCodeNotADoublesCompetition    = "NOT_A_DOUBLES_COMPETITION"
+	ErrorCodeMatchNotFound             = "MATCH_NOT_FOUND"
+	ErrorCodeInvalidSetScore           = "INVALID_SET_SCORE"
+	ErrorCodeTeamNotFound              = "TEAM_NOT_FOUND"
+	ErrorCodeInvalidPairing            = "INVALID_PAIRING"
+	ErrorCodePlayerNotFound            = "PLAYER_NOT_FOUND"
+	ErrorCodePlayerMergedWithItself    = "PLAYER_MERGED_WITH_ITSELF"
+	ErrorCodeDisciplineAlreadyEntered  = "DISCIPLINE_ALREADY_ENTERED"
+	ErrorCodeMaxEntriesExceeded        = "MAX_ENTRIES_EXCEEDED"
+	ErrorCodeCategoryNotFound          = "CATEGORY_NOT_FOUND"
+	ErrorCodeCategorizationMismatch    = "CATEGORIZATION_MISMATCH"
+	ErrorCodeCategoryPresetNotFound    = "CATEGORY_PRESET_NOT_FOUND"
+	ErrorCodeMergeFailed               = "MERGE_FAILED"
+	ErrorCodeInvalidSplit              = "INVALID_SPLIT"
+	ErrorCodeTemplateNotFound          = "TEMPLATE_NOT_FOUND"
+	ErrorCodeArchiveNotFound           = "ARCHIVE_NOT_FOUND"
+	ErrorCodeSnapshotNotFound          = "SNAPSHOT_NOT_FOUND"
+	ErrorCodeInvalidSpreadsheet        = "INVALID_SPREADSHEET"
+	ErrorCodeOrganizerAlreadyExists    = "ORGANIZER_ALREADY_EXISTS"
+	ErrorCodeDeleteRestricted          = "DELETE_RESTRICTED"
+	ErrorCodeEventLogAppendOnly        = "EVENT_LOG_APPEND_ONLY"
+	ErrorCodeRevisionConflict          = "REVISION_CONFLICT"
+)
+
+// The codes of the field errors in the details of an ApiError
+const (
+	FieldErrorCodeRequired = "REQUIRED"
+	FieldErrorCodeInvalid  = "INVALID"
+)
+
+// The error codes of records that do not exist mapped by their collection
+var notFoundErrorCodes = map[string]string{
+	names.Collections.Competitions:         ErrorCodeCompetitionNotFound,
+	names.Collections.MatchData:            ErrorCodeMatchNotFound,
+	names.Collections.Teams:                ErrorCodeTeamNotFound,
+	names.Collections.Players:              ErrorCodePlayerNotFound,
+	names.Collections.AgeGroups:            ErrorCodeCategoryNotFound,
+	names.Collections.PlayingLevels:        ErrorCodeCategoryNotFound,
+	names.Collections.CompetitionTemplates: ErrorCodeTemplateNotFound,
+	names.Collections.CompetitionArchives:  ErrorCodeArchiveNotFound,
+	names.Collections.Snapshots:            ErrorCodeSnapshotNotFound,
+}
+
+// An error of the ezbadminton API. It is the body of the error responses.
+type ApiError struct {
+	Status int    `json:"status"`
+	Code   string `json:"code"`
+
+	// The key of the message that the admin app shows in the user's language
+	MessageKey string `json:"messageKey"`
+
+	// An english description of the error that is not meant to be shown to users
+	Message string `json:"message"`
+
+	// The errors of single fields of the request mapped by the field name.
+	// The fields are named in lower camel case (e.g. "competition" or "pairings.0").
+	Details map[string]FieldError `json:"details"`
+
+	// The result of an operation that failed as a whole, listing which of its steps failed
+	Result any `json:"result"`
+}
+
+// An error of a single request field
+type FieldError struct {
+	Code       string `json:"code"`
+	MessageKey string `json:"messageKey"`
+	Message    string `json:"message"`
+}
+
+// NewApiError creates an error with the given HTTP status and error code. The message
+// key is derived from the code (e.g. "COMPETITION_ALREADY_RUNNING" becomes
+// "errors.competitionAlreadyRunning").
+func NewApiError(status int, code string, message string) *ApiError {
+	return &ApiError{
+		Status:     status,
+		Code:       code,
+		MessageKey: "errors." + messageKeyOfCode(code),
+		Message:    message,
+		Details:    map[string]FieldError{},
+	}
+}
+
+func (err *ApiError) Error() string {
+	return err.Message
+}
+
+// WithDetail adds an error of the given request field
+func (err *ApiError) WithDetail(field string, code string, message string) *ApiError {
+	err.Details[field] = FieldError{
+		Code:       code,
+		MessageKey: "errors.fields." + messageKeyOfCode(code),
+		Message:    message,
+	}
+	return err
+}
+
+// Returns an error about a request body that can not be read
+func invalidBodyError() *ApiError {
+	return NewApiError(http.StatusBadRequest, ErrorCodeInvalidRequest, "the request body is not valid JSON")
+}
+
+// Returns an error about a required request field that is missing
+func missingFieldError(field string) *ApiError {
+	return NewApiError(http.StatusBadRequest, ErrorCodeInvalidRequest, "a required field is missing").
+		WithDetail(field, FieldErrorCodeRequired, field+" is required")
+}
+
+// Returns an error about a request field with an invalid value
+func invalidFieldError(field string, message string) *ApiError {
+	return NewApiError(http.StatusBadRequest, ErrorCodeInvalidRequest, "a field has an invalid value").
+		WithDetail(field, FieldErrorCodeInvalid, message)
+}
+
+// Returns an error about an operation that the current state of the tournament does not allow
+func rejectedError(code string, message string) *ApiError {
+	return NewApiError(http.StatusBadRequest, code, message)
+}
+
+// FetchRecord finds the record of the collection with the given ID. A missing record
+// is reported with the not found error code of the collection.
+func FetchRecord(collectionName string, id string, dao core.App) (*core.Record, error) {
+	record, err := dao.FindRecordById(collectionName, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		code, hasCode := notFoundErrorCodes[collectionName]
+		if !hasCode {
+			code = ErrorCodeNotFound
+		}
+		return nil, NewApiError(http.StatusNotFound, code, id+" is not a record of "+collectionName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// RespondError sends the error as an ApiError. Errors of a missing record become NOT_FOUND errors,
+// record validation errors become VALIDATION_FAILED errors, the errors of the PocketBase API keep
+// their status and everything else becomes an INTERNAL_ERROR.
+func RespondError(e *core.RequestEvent, err error) error {
+	apiErr := ToApiError(err)
+
+	if apiErr.Status >= http.StatusInternalServerError {
+		e.App.Logger().Error("ezbadminton API error", "path", e.Request.URL.Path, "error", err)
+	}
+
+	return e.JSON(apiErr.Status, apiErr)
+}
+
+// ToApiError returns the ApiError in the chain of the error or converts the error into one
+func ToApiError(err error) *ApiError {
+	var apiErr *ApiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return NewApiError(http.StatusNotFound, ErrorCodeNotFound, "the record does not exist")
+	}
+
+	var validationErrors validation.Errors
+	if errors.As(err, &validationErrors) {
+		apiErr = NewApiError(http.StatusBadRequest, ErrorCodeValidationFailed, "the record is invalid")
+		for field, fieldErr := range validationErrors {
+			apiErr.WithDetail(field, validationErrorCode(fieldErr), fieldErr.Error())
+		}
+		return apiErr
+	}
+
+	var validationErr validation.Error
+	if errors.As(err, &validationErr) {
+		return NewApiError(http.StatusBadRequest, ErrorCodeValidationFailed, validationErr.Error())
+	}
+
+	var routerErr *router.ApiError
+	if errors.As(err, &routerErr) {
+		return fromRouterError(routerErr)
+	}
+
+	return NewApiError(http.StatusInternalServerError, ErrorCodeInternal, "the request could not be processed")
+}
+
+// Converts an error of the PocketBase API. The status and message are kept. The field
+// errors of the data become the details.
+func fromRouterError(routerErr *router.ApiError) *ApiError {
+	code := ErrorCodeInvalidRequest
+	switch {
+	case routerErr.Status == http.StatusNotFound:
+		code = ErrorCodeNotFound
+	case routerErr.Status >= http.StatusInternalServerError:
+		code = ErrorCodeInternal
+	}
+
+	apiErr := NewApiError(routerErr.Status, code, routerErr.Message)
+
+	if validationErrors, isValidation := routerErr.RawData().(validation.Errors); isValidation {
+		apiErr.Code = ErrorCodeValidationFailed
+		apiErr.MessageKey = "errors." + messageKeyOfCode(ErrorCodeValidationFailed)
+		for field, fieldErr := range validationErrors {
+			apiErr.WithDetail(field, validationErrorCode(fieldErr), fieldErr.Error())
+		}
+	}
+
+	return apiErr
+}
+
+// Returns the field error code of a validation rule error. Other errors are INVALID.
+func validationErrorCode(err error) string {
+	var codedErr validation.Error
+	if errors.As(err, &codedErr) {
+		// The codes of the validation rules look like "validation_required"
+		return strings.ToUpper(strings.TrimPrefix(codedErr.Code(), "validation_"))
+	}
+
+	return FieldErrorCodeInvalid
+}
+
+// Converts an error code like "INVALID_SET_SCORE" to the camel case "invalidSetScore"
+func messageKeyOfCode(code string) string {
+	words := strings.Split(strings.ToLower(code), "_")
+	for i := 1; i < len(words); i += 1 {
+		if words[i] != "" {
+			words[i] = strings.ToUpper(words[i][:1]) + words[i][1:]
+		}
+	}
+	return strings.Join(words, "")
+}
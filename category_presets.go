@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// A named set of categories. Age groups are given by their name (e.g. "U15") and playing
+// levels are ordered from the highest to the lowest level.
+type CategoryPreset struct {
+	Name          string
+	AgeGroups     []string
+	PlayingLevels []string
+}
+
+// The categories and competitions that have been created from category presets
+type CategoryPresetResult struct {
+	AgeGroups     []*core.Record
+	PlayingLevels []*core.Record
+	Competitions  []*core.Record
+}
+
+// The presets follow the conventions of the badminton federations. Youth age groups
+// go up in steps of two years and senior age groups in steps of five years.
+var CategoryPresets = []CategoryPreset{
+	{
+		Name:      "youth",
+		AgeGroups: []string{"U9", "U11", "U13", "U15", "U17", "U19"},
+	},
+	{
+		Name:      "seniors",
+		AgeGroups: []string{"O35", "O40", "O45", "O50", "O55", "O60", "O65", "O70", "O75"},
+	},
+	{
+		Name:          "levelsAToD",
+		PlayingLevels: []string{"A", "B", "C", "D"},
+	},
+	{
+		Name:          "levelsAdvancedToBeginner",
+		PlayingLevels: []string{"Advanced", "Intermediate", "Beginner"},
+	},
+}
+
+// The disciplines that competitions are generated for
+var presetDisciplines = []competitionSetup{
+	{GenderCategory: "male", TeamSize: 1},
+	{GenderCategory: "female", TeamSize: 1},
+	{GenderCategory: "male", TeamSize: 2},
+	{GenderCategory: "female", TeamSize: 2},
+	{GenderCategory: "mixed", TeamSize: 2},
+}
+
+// GetCategoryPresets handles GET requests to the /api/ezbadminton/category_presets route.
+// It responds with the available category presets.
+func GetCategoryPresets(e *core.RequestEvent) error {
+	return e.JSON(http.StatusOK, CategoryPresets)
+}
+
+// PostCategoryPresets handles POST requests to the /api/ezbadminton/category_presets/apply route.
+// It creates the categories of the given presets. When "Competitions" is true a competition
+// is generated for every discipline and category combination.
+func PostCategoryPresets(e *core.RequestEvent, dao core.App) error {
+	body := struct {
+		Presets      []string
+		Competitions bool
+	}{}
+
+	if err := e.BindBody(&body); err != nil {
+		return RespondError(e, invalidBodyError())
+	}
+	if len(body.Presets) == 0 {
+		return RespondError(e, missingFieldError("presets"))
+	}
+
+	result, err := ApplyCategoryPresets(body.Presets, body.Competitions, dao)
+	if err != nil {
+		return RespondError(e, err)
+	}
+
+	return e.JSON(http.StatusOK, result)
+}
+
+// ApplyCategoryPresets creates the categories of the presets that don't exist yet.
+// New playing levels are ordered after the existing ones.
+//
+// With generateCompetitions the categorizations of the presets are enabled and the missing
+// competitions for every discipline and category combination are created. Categorizations
+// that the presets don't cover are combined with all of their existing categories when the
+// tournament uses them.
+func ApplyCategoryPresets(presetNames []string, generateCompetitions bool, dao core.App) (*CategoryPresetResult, error) {
+	result := &CategoryPresetResult{
+		AgeGroups:     []*core.Record{},
+		PlayingLevels: []*core.Record{},
+		Competitions:  []*core.Record{},
+	}
+
+	presets := make([]CategoryPreset, 0, len(presetNames))
+	for _, presetName := range presetNames {
+		preset := findCategoryPreset(presetName)
+		if preset == nil {
+			return nil, NewApiError(http.StatusBadRequest, ErrorCodeCategoryPresetNotFound, "the category preset does not exist").
+				WithDetail("presets", FieldErrorCodeInvalid, fmt.Sprintf("%q is not a category preset", presetName))
+		}
+		presets = append(presets, *preset)
+	}
+
+	err := dao.RunInTransaction(func(txDao core.App) error {
+		ageGroups, err := FetchCollection(names.Collections.AgeGroups, txDao)
+		if err != nil {
+			return err
+		}
+		playingLevels, err := FetchCollection(names.Collections.PlayingLevels, txDao)
+		if err != nil {
+			return err
+		}
+
+		// The categories of the presets, including those that existed before
+		presetAgeGroups := []*core.Record{}
+		presetPlayingLevels := []*core.Record{}
+
+		for _, preset := range presets {
+			for _, ageGroupName := range preset.AgeGroups {
+				ageGroup, created, err := findOrCreateAgeGroup(ageGroups, ageGroupName, txDao)
+				if err != nil {
+					return err
+				}
+				if created {
+					ageGroups = append(ageGroups, ageGroup)
+					result.AgeGroups = append(result.AgeGroups, ageGroup)
+				}
+				presetAgeGroups = append(presetAgeGroups, ageGroup)
+			}
+
+			for _, playingLevelName := range preset.PlayingLevels {
+				playingLevel, created, err := findOrCreatePlayingLevel(playingLevels, playingLevelName, txDao)
+				if err != nil {
+					return err
+				}
+				if created {
+					playingLevels = append(playingLevels, playingLevel)
+					result.PlayingLevels = append(result.PlayingLevels, playingLevel)
+				}
+				presetPlayingLevels = append(presetPlayingLevels, playingLevel)
+			}
+		}
+
+		if !generateCompetitions {
+			return nil
+		}
+
+		tournament, err := FetchTournament(txDao)
+		if err != nil {
+			return err
+		}
+
+		ageGroupsEnabled := len(presetAgeGroups) != 0 && !tournament.GetBool(names.Fields.Tournaments.UseAgeGroups)
+		playingLevelsEnabled := len(presetPlayingLevels) != 0 && !tournament.GetBool(names.Fields.Tournaments.UsePlayingLevels)
+
+		if err := HandleEnabledCategorization(ageGroupsEnabled, playingLevelsEnabled, txDao); err != nil {
+			return err
+		}
+		if ageGroupsEnabled || playingLevelsEnabled {
+			tournament.Set(names.Fields.Tournaments.UseAgeGroups, tournament.GetBool(names.Fields.Tournaments.UseAgeGroups) || ageGroupsEnabled)
+			tournament.Set(names.Fields.Tournaments.UsePlayingLevels, tournament.GetBool(names.Fields.Tournaments.UsePlayingLevels) || playingLevelsEnabled)
+			if err := txDao.Save(tournament); err != nil {
+				return err
+			}
+		}
+
+		generatedAgeGroups := presetCategorization(presetAgeGroups, ageGroups, tournament.GetBool(names.Fields.Tournaments.UseAgeGroups))
+		generatedPlayingLevels := presetCategorization(presetPlayingLevels, playingLevels, tournament.GetBool(names.Fields.Tournaments.UsePlayingLevels))
+
+		result.Competitions, err = generatePresetCompetitions(generatedAgeGroups, generatedPlayingLevels, txDao)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func findCategoryPreset(name string) *CategoryPreset {
+	for i := range CategoryPresets {
+		if CategoryPresets[i].Name == name {
+			return &CategoryPresets[i]
+		}
+	}
+	return nil
+}
+
+// Returns the age group with the given name (e.g. "U15") and wether it had to be created
+func findOrCreateAgeGroup(ageGroups []*core.Record, name string, dao core.App) (*core.Record, bool, error) {
+	if ageGroup := findAgeGroupByName(ageGroups, name); ageGroup != nil {
+		return ageGroup, false, nil
+	}
+
+	ageGroupCollection, err := dao.FindCollectionByNameOrId(names.Collections.AgeGroups)
+	if err != nil {
+		return nil, false, err
+	}
+
+	ageGroupType, age, valid := parseAgeGroupName(name)
+	if !valid {
+		return nil, false, fmt.Errorf("%q is not a valid age group name", name)
+	}
+
+	ageGroup := core.NewRecord(ageGroupCollection)
+	ageGroup.Set(names.Fields.AgeGroups.Type, ageGroupType)
+	ageGroup.Set(names.Fields.AgeGroups.Age, age)
+
+	if err := dao.Save(ageGroup); err != nil {
+		return nil, false, err
+	}
+
+	return ageGroup, true, nil
+}
+
+// Returns the playing level with the given name and wether it had to be created.
+// A new playing level is ordered after all existing ones.
+func findOrCreatePlayingLevel(playingLevels []*core.Record, name string, dao core.App) (*core.Record, bool, error) {
+	if playingLevel := findPlayingLevelByName(playingLevels, name); playingLevel != nil {
+		return playingLevel, false, nil
+	}
+
+	playingLevelCollection, err := dao.FindCollectionByNameOrId(names.Collections.PlayingLevels)
+	if err != nil {
+		return nil, false, err
+	}
+
+	index := 0
+	for _, playingLevel := range playingLevels {
+		index = max(index, playingLevel.GetInt(names.Fields.PlayingLevels.Index)+1)
+	}
+
+	playingLevel := core.NewRecord(playingLevelCollection)
+	playingLevel.Set(names.Fields.PlayingLevels.Name, name)
+	playingLevel.Set(names.Fields.PlayingLevels.Index, index)
+
+	if err := dao.Save(playingLevel); err != nil {
+		return nil, false, err
+	}
+
+	return playingLevel, true, nil
+}
+
+// Returns the categories of one categorization that competitions are generated for.
+// These are the categories of the presets or, when the presets have none, all categories
+// if the categorization is used. A nil entry stands for no category.
+func presetCategorization(presetCategories []*core.Record, allCategories []*core.Record, useCategorization bool) []*core.Record {
+	if len(presetCategories) != 0 {
+		return presetCategories
+	}
+	if useCategorization {
+		return allCategories
+	}
+	return []*core.Record{nil}
+}
+
+// Creates a competition for every discipline, age group and playing level combination
+// that does not exist yet
+func generatePresetCompetitions(ageGroups []*core.Record, playingLevels []*core.Record, dao core.App) ([]*core.Record, error) {
+	competitionCollection, err := dao.FindCollectionByNameOrId(names.Collections.Competitions)
+	if err != nil {
+		return nil, err
+	}
+
+	competitions, err := FetchCollection(names.Collections.Competitions, dao)
+	if err != nil {
+		return nil, err
+	}
+
+	existingSetups := make(map[competitionSetup]struct{}, len(competitions))
+	for _, competition := range competitions {
+		existingSetups[setupOfCompetition(competition)] = struct{}{}
+	}
+
+	createdCompetitions := []*core.Record{}
+
+	for _, discipline := range presetDisciplines {
+		for _, ageGroup := range ageGroups {
+			for _, playingLevel := range playingLevels {
+				competition := core.NewRecord(competitionCollection)
+				competition.Set(names.Fields.Competitions.GenderCategory, discipline.GenderCategory)
+				competition.Set(names.Fields.Competitions.TeamSize, discipline.TeamSize)
+				if ageGroup != nil {
+					competition.Set(names.Fields.Competitions.AgeGroup, ageGroup.Id)
+				}
+				if playingLevel != nil {
+					competition.Set(names.Fields.Competitions.PlayingLevel, playingLevel.Id)
+				}
+
+				setup := setupOfCompetition(competition)
+				if _, exists := existingSetups[setup]; exists {
+					continue
+				}
+				existingSetups[setup] = struct{}{}
+
+				if err := dao.Save(competition); err != nil {
+					return nil, err
+				}
+
+				createdCompetitions = append(createdCompetitions, competition)
+			}
+		}
+	}
+
+	return createdCompetitions, nil
+}
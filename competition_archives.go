@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// PostRestoreCompetitionArchive handles POST requests to the /api/ezbadminton/competition_archives/restore route.
+// It puts the matches, draw and seeds of the archived run back into its competition
+// and deletes the archive. The competition must not be running.
+// The If-Match header can give the expected revision of the competition.
+func PostRestoreCompetitionArchive(e *core.RequestEvent, dao core.App) error {
+	body := struct {
+		Archive string
+	}{}
+
+	if err := e.BindBody(&body); err != nil {
+		return RespondError(e, invalidBodyError())
+	}
+	if body.Archive == "" {
+		return RespondError(e, missingFieldError("archive"))
+	}
+
+	err := dao.RunInTransaction(func(txDao core.App) error {
+		archive, err := FetchRecord(names.Collections.CompetitionArchives, body.Archive, txDao)
+		if err != nil {
+			return err
+		}
+
+		competition, err := FetchRecord(
+			names.Collections.Competitions,
+			archive.GetString(names.Fields.CompetitionArchives.Competition),
+			txDao,
+		)
+		if err != nil {
+			return err
+		}
+		if err := checkRevision(e, competition); err != nil {
+			return err
+		}
+
+		return RestoreCompetitionArchive(archive, txDao)
+	})
+	if err != nil {
+		return RespondError(e, err)
+	}
+
+	return e.NoContent(http.StatusOK)
+}
+
+// ArchiveCompetitionRun stores the matches, draw and seeds of a cancelled competition in a new
+// archive record. The competition is given in the state it had before the cancellation.
+// The matches and their sets are kept. Matches that have not ended are taken off their
+// court and lose their start time so that they do not occupy the court anymore.
+func ArchiveCompetitionRun(cancelledCompetition *core.Record, dao core.App) error {
+	archiveCollection, err := dao.FindCollectionByNameOrId(names.Collections.CompetitionArchives)
+	if err != nil {
+		return err
+	}
+
+	if err := dao.ExpandRecord(cancelledCompetition, []string{names.Fields.Competitions.Matches}, nil); len(err) != 0 {
+		return err[names.Fields.Competitions.Matches]
+	}
+
+	var startTime types.DateTime
+	for _, match := range cancelledCompetition.ExpandedAll(names.Fields.Competitions.Matches) {
+		matchStartTime := match.GetDateTime(names.Fields.MatchData.StartTime)
+		if !matchStartTime.IsZero() && (startTime.IsZero() || matchStartTime.Before(startTime)) {
+			startTime = matchStartTime
+		}
+	}
+
+	archive := core.NewRecord(archiveCollection)
+	archive.Set(names.Fields.CompetitionArchives.Competition, cancelledCompetition.Id)
+	archive.Set(names.Fields.CompetitionArchives.Matches, cancelledCompetition.GetStringSlice(names.Fields.Competitions.Matches))
+	archive.Set(names.Fields.CompetitionArchives.Draw, cancelledCompetition.GetStringSlice(names.Fields.Competitions.Draw))
+	archive.Set(names.Fields.CompetitionArchives.Seeds, cancelledCompetition.GetStringSlice(names.Fields.Competitions.Seeds))
+	archive.Set(names.Fields.CompetitionArchives.StartTime, startTime)
+
+	if err := dao.Save(archive); err != nil {
+		return err
+	}
+
+	for _, match := range WrapRecords[Match](cancelledCompetition.ExpandedAll(names.Fields.Competitions.Matches)) {
+		if !match.EndTime().IsZero() || (match.CourtId() == "" && match.StartTime().IsZero()) {
+			continue
+		}
+
+		match.SetCourtId("")
+		match.SetStartTime(types.DateTime{})
+
+		if err := dao.Save(match); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RestoreCompetitionArchive restarts the competition of the archive from the archived state
+// and deletes the archive.
+func RestoreCompetitionArchive(archive *core.Record, dao core.App) error {
+	return dao.RunInTransaction(func(txDao core.App) error {
+		competition, err := txDao.FindRecordById(
+			names.Collections.Competitions,
+			archive.GetString(names.Fields.CompetitionArchives.Competition),
+		)
+		if err != nil {
+			return err
+		}
+
+		if len(competition.GetStringSlice(names.Fields.Competitions.Matches)) != 0 {
+			return rejectedError(ErrorCodeCompetitionAlreadyRunning, "cannot restore an archived run of a running competition")
+		}
+
+		competition.Set(names.Fields.Competitions.Matches, archive.GetStringSlice(names.Fields.CompetitionArchives.Matches))
+		competition.Set(names.Fields.Competitions.Draw, archive.GetStringSlice(names.Fields.CompetitionArchives.Draw))
+		competition.Set(names.Fields.Competitions.Seeds, archive.GetStringSlice(names.Fields.CompetitionArchives.Seeds))
+
+		if err := txDao.Save(competition); err != nil {
+			return err
+		}
+
+		return txDao.Delete(archive)
+	})
+}
@@ -1,12 +1,22 @@
 package main
 
 import (
-	"errors"
+	"context"
+	"slices"
+	"strings"
 
 	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
 	"github.com/pocketbase/pocketbase/core"
 )
 
+// The relations of the competitions that grouping, merging and deleting competitions reads
+var categorizationRelationPaths = []string{
+	names.Fields.Competitions.AgeGroup,
+	names.Fields.Competitions.PlayingLevel,
+	names.Fields.Competitions.Registrations + "." + names.Fields.Teams.Players,
+	names.Fields.Competitions.Waitlist,
+}
+
 // HandleEnabledCategorization adds a category (age group or playing level) that has been enabled
 // to all competitions. Enabling a categorization without a category being present results in an error.
 // All competitions are put into the same category. It is undetermined which category that is.
@@ -58,13 +68,47 @@ func HandleEnabledCategorization(ageGroupsEnabled bool, playingLevelsEnabled boo
 
 }
 
+// The states of a merge group in a CategorizationChangeResult
+const (
+	MergeGroupStatusMerged     = "merged"
+	MergeGroupStatusFailed     = "failed"
+	MergeGroupStatusRolledBack = "rolledBack"
+	MergeGroupStatusSkipped    = "skipped"
+)
+
+// The outcome of the merges of a disabled categorization. The changes are only saved when
+// all merges succeed. Otherwise the merges before the failed one are rolled back and the
+// merges after it are skipped.
+type CategorizationChangeResult struct {
+	Merges []MergeGroupResult
+}
+
+// The outcome of merging one group of competitions
+type MergeGroupResult struct {
+	Competitions []string
+	Status       string
+
+	// The report of the merge when it has been carried out
+	Report *MergeReport
+
+	// The reason of a failed merge
+	Error *ApiError
+}
+
 // HandleDisabledCategorization removes a category (age group or playing level) that has been disabled
 // from all competitions. It also merges competitions that were previously categorized into one.
 // For example when the age group categorization becomes disabled and there exist n men's singles
 // competitions in n different age groups, then those are merged.
-func HandleDisabledCategorization(ageGroupsDisabled bool, playingLevelsDisabled bool, dao core.App) error {
+//
+// When one of the merges fails nothing is changed and the returned MERGE_FAILED error carries
+// the CategorizationChangeResult.
+func HandleDisabledCategorization(ageGroupsDisabled bool, playingLevelsDisabled bool, dao core.App) (*CategorizationChangeResult, error) {
+	result := &CategorizationChangeResult{
+		Merges: []MergeGroupResult{},
+	}
+
 	if !ageGroupsDisabled && !playingLevelsDisabled {
-		return nil
+		return result, nil
 	}
 
 	remainingCategorization := ""
@@ -76,12 +120,24 @@ func HandleDisabledCategorization(ageGroupsDisabled bool, playingLevelsDisabled
 		remainingCategorization = names.Fields.Competitions.PlayingLevel
 	}
 
-	return dao.RunInTransaction(func(txDao core.App) error {
-		competitions, fetchErr := FetchAndExpandCollection(names.Collections.Competitions, txDao)
+	// The error of the first merge that failed
+	var mergeErr error
+
+	err := dao.RunInTransaction(func(txDao core.App) error {
+		competitions, fetchErr := FetchAndExpandCollection(names.Collections.Competitions, categorizationRelationPaths, txDao)
 		if fetchErr != nil {
 			return fetchErr
 		}
 
+		// The tournament settings are not saved yet so the snapshot captures the enabled categorization
+		tournament, fetchErr := FetchTournament(txDao)
+		if fetchErr != nil {
+			return fetchErr
+		}
+		if err := captureCompetitionsSnapshot(SnapshotOperationDisableCategorization, txDao, tournament); err != nil {
+			return err
+		}
+
 		var mergeGroups [][]*core.Record = GroupCompetitions(competitions, remainingCategorization)
 
 		if ageGroupsDisabled {
@@ -96,23 +152,65 @@ func HandleDisabledCategorization(ageGroupsDisabled bool, playingLevelsDisabled
 		}
 
 		for _, group := range mergeGroups {
-			var mergeTarget *core.Record = getMergeTarget(group)
+			groupResult := MergeGroupResult{
+				Competitions: make([]string, 0, len(group)),
+				Status:       MergeGroupStatusSkipped,
+			}
+			for _, competition := range group {
+				groupResult.Competitions = append(groupResult.Competitions, competition.Id)
+			}
 
-			if err := mergeCompetitionGroup(group, mergeTarget, txDao); err != nil {
-				return nil
+			if mergeErr == nil {
+				mergeTarget, targetRule := getMergeTarget(group)
+
+				report, err := mergeCompetitionGroup(group, mergeTarget, targetRule, txDao)
+				if err != nil {
+					txDao.Logger().Error("merge of competitions failed", "competitions", groupResult.Competitions, "error", err)
+					mergeErr = err
+					groupResult.Status = MergeGroupStatusFailed
+					groupResult.Error = ToApiError(err)
+				} else {
+					groupResult.Status = MergeGroupStatusMerged
+					groupResult.Report = &report
+				}
+			}
+
+			// Groups of one competition only lose their category and are not reported
+			if len(group) > 1 || groupResult.Status == MergeGroupStatusFailed {
+				result.Merges = append(result.Merges, groupResult)
 			}
 		}
 
-		return nil
+		return mergeErr
 	})
+
+	if mergeErr != nil {
+		for i := range result.Merges {
+			if result.Merges[i].Status == MergeGroupStatusMerged {
+				result.Merges[i].Status = MergeGroupStatusRolledBack
+				result.Merges[i].Report = nil
+			}
+		}
+
+		apiErr := rejectedError(ErrorCodeMergeFailed, "the competitions could not be merged")
+		apiErr.Result = result
+		return result, apiErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
 }
 
 // HandleDeletedCategory processes the competitions that are in a category that is about to be deleted.
 // If the replacementCategoryId is not an empty string the competition's registration lists are merged
-// into the competitions of the replacement category.
-func HandleDeletedCategory(deletedCategory *core.Record, replacementCategoryId string, dao core.App) error {
-	return dao.RunInTransaction(func(txDao core.App) error {
-		competitions, fetchErr := FetchAndExpandCollection(names.Collections.Competitions, txDao)
+// into the competitions of the replacement category. The returned report lists what has been changed.
+func HandleDeletedCategory(deletedCategory *core.Record, replacementCategoryId string, dao core.App) (*CategoryChangeReport, error) {
+	report := newCategoryChangeReport()
+
+	err := dao.RunInTransaction(func(txDao core.App) error {
+		competitions, fetchErr := FetchAndExpandCollection(names.Collections.Competitions, categorizationRelationPaths, txDao)
 		if fetchErr != nil {
 			return fetchErr
 		}
@@ -131,6 +229,10 @@ func HandleDeletedCategory(deletedCategory *core.Record, replacementCategoryId s
 			return nil
 		}
 
+		if err := captureCompetitionsSnapshot(SnapshotOperationDeleteCategory, txDao, deletedCategory, tournament); err != nil {
+			return err
+		}
+
 		categories, fetchErr := FetchCollection(deletedCategory.Collection().Name, txDao)
 		if fetchErr != nil {
 			return fetchErr
@@ -138,6 +240,7 @@ func HandleDeletedCategory(deletedCategory *core.Record, replacementCategoryId s
 
 		if len(categories) == 1 {
 			// Deleting the last category disables the categorization
+			report.DisablesCategorization = true
 			tournament.Set(categorizationOptionName, false)
 			txDao.Save(tournament)
 			return nil
@@ -147,20 +250,18 @@ func HandleDeletedCategory(deletedCategory *core.Record, replacementCategoryId s
 
 		if replacementCategoryId == "" {
 			if err := ProcessAsRecords(competitionsOfDeleted, func(competition *core.Record) error {
-				return DeleteCompetitionAndTeams(competition, txDao)
+				reportDeletedCompetition(report, competition)
+				return txDao.Delete(competition)
 			}); err != nil {
 				return err
 			}
 			return nil
 		}
 
-		replacementCategory, fetchErr := txDao.FindRecordById(deletedCategory.Collection().Name, replacementCategoryId)
+		replacementCategory, fetchErr := FetchRecord(deletedCategory.Collection().Name, replacementCategoryId, txDao)
 		if fetchErr != nil {
 			return fetchErr
 		}
-		if replacementCategory == nil {
-			return errors.New("the replacement category does not exist")
-		}
 
 		competitionsOfReplacement := GetCompetitionsOfCategory(competitions, replacementCategory)
 
@@ -172,36 +273,110 @@ func HandleDeletedCategory(deletedCategory *core.Record, replacementCategoryId s
 		var mergeGroups [][]*core.Record = GroupCompetitions(competitionsToMerge, otherCategorization)
 
 		for _, group := range mergeGroups {
-			if err := mergeCategoryReplacement(group, replacementCategory, txDao); err != nil {
+			if err := mergeCategoryReplacement(group, replacementCategory, report, txDao); err != nil {
 				return err
 			}
 		}
 
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.sort()
+
+	return report, nil
 }
 
-func mergeCategoryReplacement(mergeGroup []*core.Record, replacementCategory *core.Record, dao core.App) error {
-	mergeTarget := mergeGroup[0]
+// The key of the context value that carries the replacement and report of a category deletion
+type categoryDeletionKey struct{}
 
-	if len(mergeGroup) == 1 {
-		var categoryType string = getTypeOfCategory(replacementCategory)
+type categoryDeletion struct {
+	replacementCategoryId string
+	report                *CategoryChangeReport
+}
 
-		mergeTarget.Set(categoryType, replacementCategory.Id)
+// DeleteCategory deletes the category after HandleDeletedCategory processed its competitions.
+// The deletion publishes the CategoryDeleted event with the replacement and the returned report.
+func DeleteCategory(category *core.Record, replacementCategoryId string, dao core.App) (*CategoryChangeReport, error) {
+	var report *CategoryChangeReport
 
-		if err := dao.Save(mergeTarget); err != nil {
+	err := dao.RunInTransaction(func(txDao core.App) error {
+		var err error
+		report, err = HandleDeletedCategory(category, replacementCategoryId, txDao)
+		if err != nil {
 			return err
 		}
 
-	} else if len(mergeGroup) == 2 {
-		if err := mergeCompetitionGroup(mergeGroup, mergeTarget, dao); err != nil {
-			return err
+		ctx := context.WithValue(context.Background(), categoryDeletionKey{}, &categoryDeletion{
+			replacementCategoryId: replacementCategoryId,
+			report:                report,
+		})
+
+		return txDao.DeleteWithContext(ctx, category)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// Moves the competitions of a merge group into the replacement category.
+// A group with more than one competition is merged into the competition that
+// getReplacementMergeTarget picks.
+func mergeCategoryReplacement(
+	mergeGroup []*core.Record,
+	replacementCategory *core.Record,
+	report *CategoryChangeReport,
+	dao core.App,
+) error {
+	var categoryType string = getTypeOfCategory(replacementCategory)
+
+	if len(mergeGroup) == 1 {
+		competition := mergeGroup[0]
+		if competition.GetString(categoryType) == replacementCategory.Id {
+			return nil
 		}
+
+		report.RecategorizedCompetitions = append(report.RecategorizedCompetitions, competition.Id)
+		competition.Set(categoryType, replacementCategory.Id)
+
+		return dao.Save(competition)
 	}
 
+	mergeTarget, targetRule := getReplacementMergeTarget(mergeGroup, replacementCategory)
+
+	// The merge target might be one of the competitions of the deleted category
+	mergeTarget.Set(categoryType, replacementCategory.Id)
+
+	mergeReport, err := mergeCompetitionGroup(mergeGroup, mergeTarget, targetRule, dao)
+	if err != nil {
+		return err
+	}
+
+	report.Merges = append(report.Merges, mergeReport)
+
 	return nil
 }
 
+// Returns the competition of a merge group that the others are merged into when
+// a category is replaced. Competitions that are already in the replacement category
+// are preferred over those of the deleted category.
+func getReplacementMergeTarget(mergeGroup []*core.Record, replacementCategory *core.Record) (*core.Record, string) {
+	candidates := GetCompetitionsOfCategory(mergeGroup, replacementCategory)
+
+	switch len(candidates) {
+	case 0:
+		return getMergeTarget(mergeGroup)
+	case 1:
+		return candidates[0], MergeTargetRuleReplacementCategory
+	}
+
+	return getMergeTarget(candidates)
+}
+
 // Deletes the competitions that have been merged into the merge target
 func deleteMergedCompetitions(mergeGroup []*core.Record, mergeTarget *core.Record, txDao core.App) error {
 	for _, competition := range mergeGroup {
@@ -310,48 +485,73 @@ func GroupOfCompetition(competition *core.Record, categorization string) Competi
 	return newCompetitionDiscipline
 }
 
+// The rules that pick the target of a merge
+const (
+	MergeTargetRuleOnlyCompetition        = "onlyCompetition"
+	MergeTargetRuleReplacementCategory    = "onlyInReplacementCategory"
+	MergeTargetRuleRegistrations          = "onlyWithRegistrations"
+	MergeTargetRuleDraw                   = "onlyWithDraw"
+	MergeTargetRuleSeeds                  = "onlyWithSeeds"
+	MergeTargetRuleTournamentModeSettings = "onlyWithTournamentModeSettings"
+	MergeTargetRuleOldest                 = "oldest"
+)
+
 // Returns the one competition in a group of competitions that the others should
-// be merged into.
-func getMergeTarget(competitions []*core.Record) *core.Record {
+// be merged into and the rule that picked it.
+func getMergeTarget(competitions []*core.Record) (*core.Record, string) {
 	if len(competitions) == 1 {
-		return competitions[0]
+		return competitions[0], MergeTargetRuleOnlyCompetition
 	}
 
 	// Test if there is a standout competition that is the single one that has
 	// a registrations list, a draw, seeds or tournament mode settings
 	if singleOne := GetSingle(competitions, names.Fields.Competitions.Registrations); singleOne != nil {
-		return singleOne
+		return singleOne, MergeTargetRuleRegistrations
 	}
 	if singleOne := GetSingle(competitions, names.Fields.Competitions.Draw); singleOne != nil {
-		return singleOne
+		return singleOne, MergeTargetRuleDraw
 	}
 	if singleOne := GetSingle(competitions, names.Fields.Competitions.Seeds); singleOne != nil {
-		return singleOne
+		return singleOne, MergeTargetRuleSeeds
 	}
 	if singleOne := GetSingle(competitions, names.Fields.Competitions.TournamentModeSettings); singleOne != nil {
-		return singleOne
+		return singleOne, MergeTargetRuleTournamentModeSettings
+	}
+
+	// Fall back to the oldest competition so that the pick does not depend on the fetch order
+	return slices.MinFunc(competitions, compareCreation), MergeTargetRuleOldest
+}
+
+// Orders records by their creation date. Records that were created at the same time are
+// ordered by their ID.
+func compareCreation(a, b *core.Record) int {
+	created := a.GetDateTime(names.Fields.Competitions.Created).Time().Compare(
+		b.GetDateTime(names.Fields.Competitions.Created).Time(),
+	)
+	if created != 0 {
+		return created
 	}
 
-	return competitions[0]
+	return strings.Compare(a.Id, b.Id)
 }
 
 // Merge the registered teams of the given competitions by returning three lists of teams:
 // 1. List of teams that can be directly adopted into the merged competition
 // 2. List of teams that need to newly created
 // 3. List of teams that need to be deleted
+// The conflicts explain why each of the deleted teams could not be adopted.
 func mergeRegistrations(
 	competitions []*core.Record,
 	mergeTarget *core.Record,
-) ([]*core.Record, []*core.Record, []*core.Record) {
+) ([]*core.Record, []*core.Record, []*core.Record, []MergeConflict) {
+	// The merge target might have no registrations. The teams of the other competitions
+	// are adopted into it all the same.
 	var allTeams []*core.Record = mergeTarget.ExpandedAll(names.Fields.Competitions.Registrations)
 
 	adoptedTeams := []*core.Record{}
 	newTeams := []*core.Record{}
 	deletedTeams := []*core.Record{}
-
-	if len(allTeams) == 0 {
-		return adoptedTeams, newTeams, deletedTeams
-	}
+	conflicts := []MergeConflict{}
 
 	for _, competition := range competitions {
 		if competition != mergeTarget {
@@ -360,14 +560,15 @@ func mergeRegistrations(
 	}
 
 	if len(allTeams) == 0 {
-		return adoptedTeams, newTeams, deletedTeams
+		return adoptedTeams, newTeams, deletedTeams, conflicts
 	}
 
 	// Initially all teams and players are unadopted
 	unadoptedTeamSet := make(map[*core.Record]struct{}, len(allTeams))
 
 	unadoptedPlayerSet := make(map[*core.Record]struct{}, len(allTeams))
-	adoptedPlayerSet := make(map[*core.Record]struct{}, len(allTeams))
+	// The adopted players mapped to the team that they have been adopted with
+	adoptedPlayerSet := make(map[*core.Record]*core.Record, len(allTeams))
 
 	for _, team := range allTeams {
 		unadoptedTeamSet[team] = struct{}{}
@@ -381,8 +582,13 @@ func mergeRegistrations(
 	for _, team := range allTeams {
 		alreadyAdopted := false
 		for _, player := range team.ExpandedAll(names.Fields.Teams.Players) {
-			if _, isAdopted := adoptedPlayerSet[player]; isAdopted {
+			if adoptedTeam, isAdopted := adoptedPlayerSet[player]; isAdopted {
 				alreadyAdopted = true
+				conflicts = append(conflicts, MergeConflict{
+					Team:        team.Id,
+					Player:      player.Id,
+					AdoptedTeam: adoptedTeam.Id,
+				})
 				break
 			}
 		}
@@ -394,7 +600,7 @@ func mergeRegistrations(
 		adoptedTeams = append(adoptedTeams, team)
 		delete(unadoptedTeamSet, team)
 		for _, player := range team.ExpandedAll(names.Fields.Teams.Players) {
-			adoptedPlayerSet[player] = struct{}{}
+			adoptedPlayerSet[player] = team
 			delete(unadoptedPlayerSet, player)
 		}
 	}
@@ -404,7 +610,7 @@ func mergeRegistrations(
 	var teamCollection *core.Collection = allTeams[0].Collection()
 	for player := range unadoptedPlayerSet {
 		newTeam := core.NewRecord(teamCollection)
-		newTeam.Set("players", []*core.Record{player})
+		newTeam.Set(names.Fields.Teams.Players, []string{player.Id})
 		newTeams = append(newTeams, newTeam)
 	}
 
@@ -413,14 +619,22 @@ func mergeRegistrations(
 		deletedTeams = append(deletedTeams, team)
 	}
 
-	return adoptedTeams, newTeams, deletedTeams
+	return adoptedTeams, newTeams, deletedTeams, conflicts
 }
 
-func mergeCompetitionGroup(mergeGroup []*core.Record, mergeTarget *core.Record, dao core.App) error {
-	return dao.RunInTransaction(func(txDao core.App) error {
+// Merges the competitions of the group into the merge target that has been picked by the
+// targetRule. Merges of more than one competition are logged in the merge logs.
+func mergeCompetitionGroup(
+	mergeGroup []*core.Record,
+	mergeTarget *core.Record,
+	targetRule string,
+	dao core.App,
+) (MergeReport, error) {
+	adoptedTeams, newTeams, deletedTeams, conflicts := mergeRegistrations(mergeGroup, mergeTarget)
 
-		var adoptedTeams, newTeams, deletedTeams []*core.Record = mergeRegistrations(mergeGroup, mergeTarget)
+	report := buildMergeReport(mergeGroup, mergeTarget, targetRule, adoptedTeams, newTeams, deletedTeams, conflicts)
 
+	err := dao.RunInTransaction(func(txDao core.App) error {
 		if err := ProcessAsModels(newTeams, txDao.Save); err != nil {
 			return err
 		}
@@ -436,6 +650,7 @@ func mergeCompetitionGroup(mergeGroup []*core.Record, mergeTarget *core.Record,
 			updatedRegistrations = append(updatedRegistrations, team.Id)
 		}
 		mergeTarget.Set(names.Fields.Competitions.Registrations, updatedRegistrations)
+		mergeTarget.Set(names.Fields.Competitions.Waitlist, mergeWaitlists(mergeGroup, mergeTarget))
 
 		if err := txDao.Save(mergeTarget); err != nil {
 			return err
@@ -444,8 +659,28 @@ func mergeCompetitionGroup(mergeGroup []*core.Record, mergeTarget *core.Record,
 			return err
 		}
 
+		if len(mergeGroup) > 1 {
+			return saveMergeLog(report, txDao)
+		}
+
 		return nil
 	})
+
+	return report, err
+}
+
+// Returns the waitlist of the merge target followed by the waitlists of the
+// other competitions in the merge group
+func mergeWaitlists(mergeGroup []*core.Record, mergeTarget *core.Record) []string {
+	waitlist := mergeTarget.GetStringSlice(names.Fields.Competitions.Waitlist)
+
+	for _, competition := range mergeGroup {
+		if competition != mergeTarget {
+			waitlist = append(waitlist, competition.GetStringSlice(names.Fields.Competitions.Waitlist)...)
+		}
+	}
+
+	return waitlist
 }
 
 // Returns what type of category the given model represents.
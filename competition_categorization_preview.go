@@ -0,0 +1,298 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// The outcome of merging a group of competitions
+type MergeReport struct {
+	Competitions []string
+	MergeTarget  string
+	// The rule of getMergeTarget that picked the merge target
+	TargetRule string
+
+	// The teams that are registered for the merged competition as they are
+	AdoptedTeams []string
+	// The players that are registered with a new team of their own
+	// because their team could not be adopted
+	SplitPlayers []string
+	DeletedTeams []string
+	LostPartners []LostPartner
+	// Why the deleted teams could not be adopted
+	Conflicts []MergeConflict
+}
+
+// A team that could not be adopted into a merged competition because one of its
+// players was already adopted with another team
+type MergeConflict struct {
+	Team        string
+	Player      string
+	AdoptedTeam string
+}
+
+// A player that is no longer registered together with a former partner after a merge
+type LostPartner struct {
+	Player  string
+	Partner string
+}
+
+// The outcome of deleting a category or of disabling a categorization
+type CategoryChangeReport struct {
+	// Deleting the last category of a categorization disables the categorization
+	DisablesCategorization bool
+
+	DeletedCompetitions []string
+	DeletedTeams        []string
+
+	// The competitions that are moved into the replacement category without a merge
+	RecategorizedCompetitions []string
+
+	Merges []MergeReport
+}
+
+// GetCategoryDeletionPreview handles GET requests to the /api/ezbadminton/{age_groups|playing_levels}/deletion-preview route.
+// It responds with what HandleDeletedCategory would do when the "category" from the query
+// parameters is deleted with the optional "replacement" category. Nothing is changed.
+func GetCategoryDeletionPreview(e *core.RequestEvent, collectionName string, dao core.App) error {
+	categoryId := e.Request.URL.Query().Get("category")
+	replacementCategoryId := e.Request.URL.Query().Get("replacement")
+
+	category, err := FetchRecord(collectionName, categoryId, dao)
+	if err != nil {
+		return RespondError(e, err)
+	}
+
+	preview, err := PreviewDeletedCategory(category, replacementCategoryId, dao)
+	if err != nil {
+		return RespondError(e, err)
+	}
+
+	return e.JSON(http.StatusOK, preview)
+}
+
+// GetCategorizationPreview handles GET requests to the /api/ezbadminton/tournaments/categorization-preview route.
+// It responds with what HandleDisabledCategorization would do when the tournament settings were
+// updated to the "useAgeGroups" and "usePlayingLevels" query parameters. Omitted parameters
+// keep their current setting. Nothing is changed.
+func GetCategorizationPreview(e *core.RequestEvent, dao core.App) error {
+	tournament, err := FetchTournament(dao)
+	if err != nil {
+		return RespondError(e, err)
+	}
+
+	query := e.Request.URL.Query()
+
+	useAgeGroups := tournament.GetBool(names.Fields.Tournaments.UseAgeGroups)
+	usePlayingLevels := tournament.GetBool(names.Fields.Tournaments.UsePlayingLevels)
+
+	ageGroupsDisabled := useAgeGroups && query.Get(names.Fields.Tournaments.UseAgeGroups) == "false"
+	playingLevelsDisabled := usePlayingLevels && query.Get(names.Fields.Tournaments.UsePlayingLevels) == "false"
+
+	preview, err := PreviewDisabledCategorization(ageGroupsDisabled, playingLevelsDisabled, dao)
+	if err != nil {
+		return RespondError(e, err)
+	}
+
+	return e.JSON(http.StatusOK, preview)
+}
+
+// PreviewDisabledCategorization returns the merges that HandleDisabledCategorization
+// would carry out without writing anything.
+func PreviewDisabledCategorization(ageGroupsDisabled bool, playingLevelsDisabled bool, dao core.App) (*CategoryChangeReport, error) {
+	preview := newCategoryChangeReport()
+
+	if !ageGroupsDisabled && !playingLevelsDisabled {
+		return preview, nil
+	}
+
+	remainingCategorization := ""
+
+	if !ageGroupsDisabled {
+		remainingCategorization = names.Fields.Competitions.AgeGroup
+	}
+	if !playingLevelsDisabled {
+		remainingCategorization = names.Fields.Competitions.PlayingLevel
+	}
+
+	competitions, err := FetchAndExpandCollection(names.Collections.Competitions, categorizationRelationPaths, dao)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, group := range GroupCompetitions(competitions, remainingCategorization) {
+		if len(group) < 2 {
+			continue
+		}
+		mergeTarget, targetRule := getMergeTarget(group)
+		preview.Merges = append(preview.Merges, reportMerge(group, mergeTarget, targetRule))
+	}
+
+	preview.sort()
+
+	return preview, nil
+}
+
+// PreviewDeletedCategory returns what HandleDeletedCategory would do with the
+// competitions of the deleted category without writing anything.
+func PreviewDeletedCategory(deletedCategory *core.Record, replacementCategoryId string, dao core.App) (*CategoryChangeReport, error) {
+	preview := newCategoryChangeReport()
+
+	competitions, err := FetchAndExpandCollection(names.Collections.Competitions, categorizationRelationPaths, dao)
+	if err != nil {
+		return nil, err
+	}
+
+	tournament, err := FetchTournament(dao)
+	if err != nil {
+		return nil, err
+	}
+
+	if !tournament.GetBool(getOptionNameOfCategory(deletedCategory)) || len(competitions) == 0 {
+		return preview, nil
+	}
+
+	categories, err := FetchCollection(deletedCategory.Collection().Name, dao)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(categories) == 1 {
+		preview.DisablesCategorization = true
+		return preview, nil
+	}
+
+	competitionsOfDeleted := GetCompetitionsOfCategory(competitions, deletedCategory)
+
+	if replacementCategoryId == "" {
+		for _, competition := range competitionsOfDeleted {
+			reportDeletedCompetition(preview, competition)
+		}
+		return preview, nil
+	}
+
+	replacementCategory, err := FetchRecord(deletedCategory.Collection().Name, replacementCategoryId, dao)
+	if err != nil {
+		return nil, err
+	}
+
+	competitionsToMerge := append(
+		GetCompetitionsOfCategory(competitions, replacementCategory),
+		competitionsOfDeleted...,
+	)
+
+	otherCategorization := getInvertedTypeOfCategory(replacementCategory)
+
+	for _, group := range GroupCompetitions(competitionsToMerge, otherCategorization) {
+		if len(group) > 1 {
+			mergeTarget, targetRule := getReplacementMergeTarget(group, replacementCategory)
+			preview.Merges = append(preview.Merges, reportMerge(group, mergeTarget, targetRule))
+		} else if group[0].GetString(getTypeOfCategory(replacementCategory)) != replacementCategory.Id {
+			preview.RecategorizedCompetitions = append(preview.RecategorizedCompetitions, group[0].Id)
+		}
+	}
+
+	preview.sort()
+
+	return preview, nil
+}
+
+func newCategoryChangeReport() *CategoryChangeReport {
+	return &CategoryChangeReport{
+		DeletedCompetitions:       []string{},
+		DeletedTeams:              []string{},
+		RecategorizedCompetitions: []string{},
+		Merges:                    []MergeReport{},
+	}
+}
+
+// Sorts the lists of the report because the competitions are grouped in random order
+func (report *CategoryChangeReport) sort() {
+	slices.Sort(report.RecategorizedCompetitions)
+	slices.SortFunc(report.Merges, func(a, b MergeReport) int { return strings.Compare(a.MergeTarget, b.MergeTarget) })
+}
+
+// Adds the competition and its registered and waitlisted teams to the deleted records of the report.
+// The teams have to be expanded.
+func reportDeletedCompetition(report *CategoryChangeReport, competition *core.Record) {
+	report.DeletedCompetitions = append(report.DeletedCompetitions, competition.Id)
+	for _, team := range competition.ExpandedAll(names.Fields.Competitions.Registrations) {
+		report.DeletedTeams = append(report.DeletedTeams, team.Id)
+	}
+	for _, team := range competition.ExpandedAll(names.Fields.Competitions.Waitlist) {
+		report.DeletedTeams = append(report.DeletedTeams, team.Id)
+	}
+}
+
+// Returns the outcome of mergeRegistrations for the merge group. The registrations
+// and their players have to be expanded.
+func reportMerge(mergeGroup []*core.Record, mergeTarget *core.Record, targetRule string) MergeReport {
+	adoptedTeams, newTeams, deletedTeams, conflicts := mergeRegistrations(mergeGroup, mergeTarget)
+
+	return buildMergeReport(mergeGroup, mergeTarget, targetRule, adoptedTeams, newTeams, deletedTeams, conflicts)
+}
+
+// Returns the report of the teams that mergeRegistrations returned for the merge group
+func buildMergeReport(
+	mergeGroup []*core.Record,
+	mergeTarget *core.Record,
+	targetRule string,
+	adoptedTeams []*core.Record,
+	newTeams []*core.Record,
+	deletedTeams []*core.Record,
+	conflicts []MergeConflict,
+) MergeReport {
+	report := MergeReport{
+		Competitions: make([]string, 0, len(mergeGroup)),
+		MergeTarget:  mergeTarget.Id,
+		TargetRule:   targetRule,
+		AdoptedTeams: make([]string, 0, len(adoptedTeams)),
+		SplitPlayers: make([]string, 0, len(newTeams)),
+		DeletedTeams: make([]string, 0, len(deletedTeams)),
+		LostPartners: []LostPartner{},
+		Conflicts:    conflicts,
+	}
+
+	for _, competition := range mergeGroup {
+		report.Competitions = append(report.Competitions, competition.Id)
+	}
+
+	// The players of the merged competition mapped to their team members
+	teamOfPlayer := make(map[string][]string, len(adoptedTeams)+len(newTeams))
+
+	for _, team := range adoptedTeams {
+		report.AdoptedTeams = append(report.AdoptedTeams, team.Id)
+		for _, playerId := range team.GetStringSlice(names.Fields.Teams.Players) {
+			teamOfPlayer[playerId] = team.GetStringSlice(names.Fields.Teams.Players)
+		}
+	}
+	for _, team := range newTeams {
+		for _, playerId := range team.GetStringSlice(names.Fields.Teams.Players) {
+			report.SplitPlayers = append(report.SplitPlayers, playerId)
+			teamOfPlayer[playerId] = team.GetStringSlice(names.Fields.Teams.Players)
+		}
+	}
+	// The map iterations in mergeRegistrations return the new and deleted teams in random order
+	slices.Sort(report.SplitPlayers)
+	slices.SortFunc(deletedTeams, func(a, b *core.Record) int { return strings.Compare(a.Id, b.Id) })
+
+	for _, team := range deletedTeams {
+		report.DeletedTeams = append(report.DeletedTeams, team.Id)
+
+		players := team.GetStringSlice(names.Fields.Teams.Players)
+		for _, playerId := range players {
+			for _, partnerId := range players {
+				if partnerId != playerId && !slices.Contains(teamOfPlayer[playerId], partnerId) {
+					report.LostPartners = append(report.LostPartners, LostPartner{playerId, partnerId})
+				}
+			}
+		}
+	}
+
+	return report
+}
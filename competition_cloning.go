@@ -0,0 +1,164 @@
+package main
+
+import (
+	"net/http"
+
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// PostCompetitionClone handles POST requests to the /api/ezbadminton/competitions/clone route.
+// It responds with the clone of the given competition. When "Registrations" is true
+// the registered teams are copied into the clone.
+func PostCompetitionClone(e *core.RequestEvent, dao core.App) error {
+	body := struct {
+		Competition   string
+		Registrations bool
+	}{}
+
+	if err := e.BindBody(&body); err != nil {
+		return RespondError(e, invalidBodyError())
+	}
+	if body.Competition == "" {
+		return RespondError(e, missingFieldError("competition"))
+	}
+
+	clone, err := CloneCompetition(body.Competition, body.Registrations, dao)
+	if err != nil {
+		return RespondError(e, err)
+	}
+
+	return e.JSON(http.StatusOK, clone)
+}
+
+// CloneCompetition creates a new competition with the discipline, categories, tournament mode
+// settings and tie breakers of the given competition.
+//
+// The registered teams are copied when withRegistrations is true. The clone shares the discipline
+// of the given competition, so the copied teams only have to stay within the tournament's limit
+// of entries per player (see validatePlayerEntries).
+func CloneCompetition(competitionId string, withRegistrations bool, dao core.App) (*core.Record, error) {
+	var clone *core.Record
+
+	err := dao.RunInTransaction(func(txDao core.App) error {
+		competition, err := FetchRecord(names.Collections.Competitions, competitionId, txDao)
+		if err != nil {
+			return err
+		}
+
+		clone, err = copyCompetition(competition, txDao)
+		if err != nil {
+			return err
+		}
+
+		// The IDs of the copied teams mapped by the IDs of the original teams
+		teamCopies := map[string]string{}
+
+		if withRegistrations {
+			if err := txDao.ExpandRecord(competition, []string{names.Fields.Competitions.Registrations}, nil); len(err) != 0 {
+				return err[names.Fields.Competitions.Registrations]
+			}
+
+			registrations := make([]string, 0, len(competition.GetStringSlice(names.Fields.Competitions.Registrations)))
+			for _, team := range competition.ExpandedAll(names.Fields.Competitions.Registrations) {
+				if err := validatePlayerEntries(team, clone, txDao, competition.Id); err != nil {
+					return err
+				}
+
+				teamCopy, err := copyRecord(team, txDao)
+				if err != nil {
+					return err
+				}
+				teamCopies[team.Id] = teamCopy.Id
+				registrations = append(registrations, teamCopy.Id)
+			}
+
+			clone.Set(names.Fields.Competitions.Registrations, registrations)
+		}
+
+		if err := txDao.ExpandRecord(competition, []string{names.Fields.Competitions.TieBreakers}, nil); len(err) != 0 {
+			return err[names.Fields.Competitions.TieBreakers]
+		}
+
+		tieBreakers := make([]string, 0, len(competition.GetStringSlice(names.Fields.Competitions.TieBreakers)))
+		for _, tieBreaker := range competition.ExpandedAll(names.Fields.Competitions.TieBreakers) {
+			tieBreakerCopy := tieBreaker.Fresh()
+
+			// Rank the copied teams when there are any
+			ranking := tieBreakerCopy.GetStringSlice(names.Fields.TieBreakers.TieBreakerRanking)
+			for i, teamId := range ranking {
+				if teamCopyId, copied := teamCopies[teamId]; copied {
+					ranking[i] = teamCopyId
+				}
+			}
+			tieBreakerCopy.Set(names.Fields.TieBreakers.TieBreakerRanking, ranking)
+
+			savedTieBreaker, err := copyRecord(tieBreakerCopy, txDao)
+			if err != nil {
+				return err
+			}
+			tieBreakers = append(tieBreakers, savedTieBreaker.Id)
+		}
+
+		clone.Set(names.Fields.Competitions.TieBreakers, tieBreakers)
+
+		return txDao.Save(clone)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return clone, nil
+}
+
+// Returns an unsaved competition with the discipline, categories and entry limit of the given one.
+// The tournament mode settings are copied.
+func copyCompetition(competition *core.Record, dao core.App) (*core.Record, error) {
+	newCompetition := core.NewRecord(competition.Collection())
+
+	for _, fieldName := range []string{
+		names.Fields.Competitions.GenderCategory,
+		names.Fields.Competitions.TeamSize,
+		names.Fields.Competitions.AgeGroup,
+		names.Fields.Competitions.PlayingLevel,
+		names.Fields.Competitions.MaxEntries,
+	} {
+		newCompetition.Set(fieldName, competition.Get(fieldName))
+	}
+
+	settingsId := competition.GetString(names.Fields.Competitions.TournamentModeSettings)
+	if settingsId != "" {
+		settings, err := dao.FindRecordById(names.Collections.TournamentModeSettings, settingsId)
+		if err != nil {
+			return nil, err
+		}
+
+		settingsCopy, err := copyRecord(settings, dao)
+		if err != nil {
+			return nil, err
+		}
+
+		newCompetition.Set(names.Fields.Competitions.TournamentModeSettings, settingsCopy.Id)
+	}
+
+	return newCompetition, nil
+}
+
+// Saves a new record with the field values of the given record
+func copyRecord(record *core.Record, dao core.App) (*core.Record, error) {
+	recordCopy := core.NewRecord(record.Collection())
+
+	for _, field := range record.Collection().Fields {
+		if field.GetName() == core.FieldNameId || field.Type() == core.FieldTypeAutodate {
+			continue
+		}
+		recordCopy.Set(field.GetName(), record.Get(field.GetName()))
+	}
+
+	if err := dao.Save(recordCopy); err != nil {
+		return nil, err
+	}
+
+	return recordCopy, nil
+}
@@ -0,0 +1,126 @@
+// PocketBase cannot load its collections with the experimental encoding/json v2
+//go:build !goexperiment.jsonv2
+
+package main
+
+import (
+	"errors"
+	"testing"
+
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+// Creates an app with an empty, migrated database
+func newTestApp(t *testing.T) *tests.TestApp {
+	t.Helper()
+
+	app, err := tests.NewTestApp(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(app.Cleanup)
+
+	return app
+}
+
+// Saves a new record of the collection with the data
+func saveTestRecord(t *testing.T, app core.App, collection string, data map[string]any) *core.Record {
+	t.Helper()
+
+	recordCollection, err := app.FindCollectionByNameOrId(collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := core.NewRecord(recordCollection)
+	record.Load(data)
+
+	if err := app.Save(record); err != nil {
+		t.Fatalf("could not save the %s record: %v", collection, err)
+	}
+
+	return record
+}
+
+func TestCloneCompetitionWithRegistrations(t *testing.T) {
+	scenarios := []struct {
+		name              string
+		maxEntries        int
+		expectedErrorCode string
+	}{
+		{"unlimited entries", 0, ""},
+		{"the clone is within the entry limit", 2, ""},
+		{"the clone exceeds the entry limit", 1, ErrorCodeMaxEntriesExceeded},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			app := newTestApp(t)
+
+			tournament, err := FetchTournament(app)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tournament.Set(names.Fields.Tournaments.MaxEntriesPerPlayer, s.maxEntries)
+			if err := app.Save(tournament); err != nil {
+				t.Fatal(err)
+			}
+
+			teams := []string{}
+			for _, name := range []string{"Anna", "Jan"} {
+				player := saveTestRecord(t, app, names.Collections.Players, map[string]any{
+					names.Fields.Players.FirstName: name,
+					names.Fields.Players.LastName:  "Berg",
+					names.Fields.Players.Status:    "attending",
+				})
+				team := saveTestRecord(t, app, names.Collections.Teams, map[string]any{
+					names.Fields.Teams.Players: []string{player.Id},
+				})
+				teams = append(teams, team.Id)
+			}
+
+			competition := saveTestRecord(t, app, names.Collections.Competitions, map[string]any{
+				names.Fields.Competitions.TeamSize:       1,
+				names.Fields.Competitions.GenderCategory: "female",
+				names.Fields.Competitions.Registrations:  teams,
+			})
+
+			clone, err := CloneCompetition(competition.Id, true, app)
+
+			if s.expectedErrorCode != "" {
+				var apiErr *ApiError
+				if !errors.As(err, &apiErr) || apiErr.Code != s.expectedErrorCode {
+					t.Fatalf("expected the error code %s, got %v", s.expectedErrorCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			registrations := clone.GetStringSlice(names.Fields.Competitions.Registrations)
+			if len(registrations) != len(teams) {
+				t.Fatalf("expected %d registrations, got %d", len(teams), len(registrations))
+			}
+			for i, teamCopyId := range registrations {
+				original, err := app.FindRecordById(names.Collections.Teams, teams[i])
+				if err != nil {
+					t.Fatal(err)
+				}
+				teamCopy, err := app.FindRecordById(names.Collections.Teams, teamCopyId)
+				if err != nil {
+					t.Fatalf("expected the copied team to be saved: %v", err)
+				}
+
+				if teamCopy.Id == original.Id {
+					t.Fatal("expected the clone to register copies of the teams")
+				}
+				if teamCopy.GetString(names.Fields.Teams.Players) != original.GetString(names.Fields.Teams.Players) {
+					t.Fatalf("expected the copy of team %s to have the same players", original.Id)
+				}
+			}
+		})
+	}
+}
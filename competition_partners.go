@@ -0,0 +1,352 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// A proposed pairing of two teams that each consist of a single player
+type PartnerPairing struct {
+	Team1   string
+	Team2   string
+	Player1 string
+	Player2 string
+}
+
+type PartnerProposal struct {
+	Competition string
+	Pairings    []PartnerPairing
+
+	// The single-player teams that could not be paired
+	Unpaired []string
+}
+
+// GetPartnerProposal handles GET requests to the /api/ezbadminton/competitions/partners route.
+// It responds with a proposal of pairings for the players that are registered
+// without a partner in the doubles or mixed competition given by the "competition" query parameter.
+// The optional "club" query parameter ("same" or "different") states a preference for
+// partners from the same or from different clubs.
+func GetPartnerProposal(e *core.RequestEvent, dao core.App) error {
+	competitionId := e.Request.URL.Query().Get("competition")
+	clubPreference := e.Request.URL.Query().Get("club")
+
+	if competitionId == "" {
+		return RespondError(e, missingFieldError("competition"))
+	}
+
+	competition, err := FetchRecord(names.Collections.Competitions, competitionId, dao)
+	if err != nil {
+		return RespondError(e, err)
+	}
+
+	proposal, err := FindPartners(competition, clubPreference, dao)
+	if err != nil {
+		return RespondError(e, err)
+	}
+
+	return e.JSON(http.StatusOK, proposal)
+}
+
+// PostPartnerPairings handles POST requests to the /api/ezbadminton/competitions/partners route.
+// It applies the pairings of a partner proposal to the competition in one transaction.
+// The If-Match header can give the expected revision of the competition.
+func PostPartnerPairings(e *core.RequestEvent, dao core.App) error {
+	body := struct {
+		Competition string
+		Pairings    []PartnerPairing
+	}{}
+
+	if err := e.BindBody(&body); err != nil {
+		return RespondError(e, invalidBodyError())
+	}
+	if body.Competition == "" {
+		return RespondError(e, missingFieldError("competition"))
+	}
+
+	err := dao.RunInTransaction(func(txDao core.App) error {
+		competition, err := FetchRecord(names.Collections.Competitions, body.Competition, txDao)
+		if err != nil {
+			return err
+		}
+		if err := checkRevision(e, competition); err != nil {
+			return err
+		}
+
+		return ApplyPartnerPairings(body.Competition, body.Pairings, txDao)
+	})
+	if err != nil {
+		return RespondError(e, err)
+	}
+
+	return e.NoContent(http.StatusOK)
+}
+
+// FindPartners proposes pairings for the single-player teams of a doubles or mixed competition.
+// Partners have to fit the gender category of the competition and are chosen to have similar
+// playing levels. The clubPreference ("same", "different" or "") is only considered after
+// the playing level.
+func FindPartners(competition *core.Record, clubPreference string, dao core.App) (*PartnerProposal, error) {
+	if competition.GetInt(names.Fields.Competitions.TeamSize) != 2 {
+		return nil, rejectedError(ErrorCodeNotADoublesCompetition, "partners can only be found for doubles and mixed competitions")
+	}
+
+	singlePlayerTeams, err := fetchSinglePlayerTeams(competition, dao)
+	if err != nil {
+		return nil, err
+	}
+
+	genderCategory := competition.GetString(names.Fields.Competitions.GenderCategory)
+
+	type candidate struct {
+		team1 int
+		team2 int
+		cost  int
+	}
+
+	candidates := make([]candidate, 0, len(singlePlayerTeams)*len(singlePlayerTeams)/2)
+
+	for i := 0; i < len(singlePlayerTeams); i += 1 {
+		player1 := singlePlayerTeams[i].ExpandedOne(names.Fields.Teams.Players)
+		for j := i + 1; j < len(singlePlayerTeams); j += 1 {
+			player2 := singlePlayerTeams[j].ExpandedOne(names.Fields.Teams.Players)
+
+			if !doGendersFit(player1, player2, genderCategory) {
+				continue
+			}
+
+			candidates = append(candidates, candidate{
+				team1: i,
+				team2: j,
+				cost:  partnerCost(player1, player2, clubPreference),
+			})
+		}
+	}
+
+	// The stable sort keeps the registration order for pairings of equal cost
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return candidates[a].cost < candidates[b].cost
+	})
+
+	paired := make([]bool, len(singlePlayerTeams))
+
+	proposal := &PartnerProposal{
+		Competition: competition.Id,
+		Pairings:    []PartnerPairing{},
+		Unpaired:    []string{},
+	}
+
+	for _, c := range candidates {
+		if paired[c.team1] || paired[c.team2] {
+			continue
+		}
+		paired[c.team1] = true
+		paired[c.team2] = true
+
+		team1 := singlePlayerTeams[c.team1]
+		team2 := singlePlayerTeams[c.team2]
+
+		proposal.Pairings = append(proposal.Pairings, PartnerPairing{
+			Team1:   team1.Id,
+			Team2:   team2.Id,
+			Player1: team1.GetStringSlice(names.Fields.Teams.Players)[0],
+			Player2: team2.GetStringSlice(names.Fields.Teams.Players)[0],
+		})
+	}
+
+	for i, team := range singlePlayerTeams {
+		if !paired[i] {
+			proposal.Unpaired = append(proposal.Unpaired, team.Id)
+		}
+	}
+
+	return proposal, nil
+}
+
+// ApplyPartnerPairings joins the teams of each pairing. The player of Team2 becomes
+// the partner in Team1 and Team2 is deleted. The players of a pairing have to fit the
+// gender category of the competition and the entry limits (see validatePlayerEntries).
+func ApplyPartnerPairings(competitionId string, pairings []PartnerPairing, dao core.App) error {
+	return dao.RunInTransaction(func(txDao core.App) error {
+		competition, err := FetchRecord(names.Collections.Competitions, competitionId, txDao)
+		if err != nil {
+			return err
+		}
+
+		if len(competition.GetStringSlice(names.Fields.Competitions.Matches)) != 0 {
+			return rejectedError(ErrorCodeCompetitionAlreadyRunning, "cannot change the teams of a running competition")
+		}
+
+		singlePlayerTeams, err := fetchSinglePlayerTeams(competition, txDao)
+		if err != nil {
+			return err
+		}
+
+		teamsById := make(map[string]*core.Record, len(singlePlayerTeams))
+		for _, team := range singlePlayerTeams {
+			teamsById[team.Id] = team
+		}
+
+		genderCategory := competition.GetString(names.Fields.Competitions.GenderCategory)
+
+		dissolvedTeams := make([]*core.Record, 0, len(pairings))
+
+		for i, pairing := range pairings {
+			team1, exists1 := teamsById[pairing.Team1]
+			team2, exists2 := teamsById[pairing.Team2]
+
+			if !exists1 || !exists2 || team1 == team2 {
+				return rejectedError(ErrorCodeInvalidPairing, "the pairing cannot be applied").WithDetail(
+					fmt.Sprintf("pairings.%d", i),
+					FieldErrorCodeInvalid,
+					"pairings can only join distinct single-player teams of the competition",
+				)
+			}
+			// Each team can only be part of one pairing
+			delete(teamsById, pairing.Team1)
+			delete(teamsById, pairing.Team2)
+
+			player1 := team1.ExpandedOne(names.Fields.Teams.Players)
+			player2 := team2.ExpandedOne(names.Fields.Teams.Players)
+
+			if !doGendersFit(player1, player2, genderCategory) {
+				return rejectedError(ErrorCodeInvalidPairing, "the pairing cannot be applied").WithDetail(
+					fmt.Sprintf("pairings.%d", i),
+					FieldErrorCodeInvalid,
+					"the players do not fit the gender category of the competition",
+				)
+			}
+
+			team1.Set(names.Fields.Teams.Players, append(
+				team1.GetStringSlice(names.Fields.Teams.Players),
+				team2.GetStringSlice(names.Fields.Teams.Players)...,
+			))
+
+			if err := validatePlayerEntries(team1, competition, txDao); err != nil {
+				return err
+			}
+
+			if err := txDao.Save(team1); err != nil {
+				return err
+			}
+
+			dissolvedTeams = append(dissolvedTeams, team2)
+		}
+
+		removeTeamsFromCompetition(competition, dissolvedTeams)
+
+		if err := txDao.Save(competition); err != nil {
+			return err
+		}
+
+		if err := ProcessAsModels(dissolvedTeams, txDao.Delete); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// Returns the registered teams of the competition that consist of only one player.
+// The player relation of the teams is expanded.
+func fetchSinglePlayerTeams(competition *core.Record, dao core.App) ([]*core.Record, error) {
+	if err := dao.ExpandRecord(competition, []string{names.Fields.Competitions.Registrations}, nil); len(err) != 0 {
+		return nil, err[names.Fields.Competitions.Registrations]
+	}
+	registeredTeams := competition.ExpandedAll(names.Fields.Competitions.Registrations)
+
+	singlePlayerTeams := make([]*core.Record, 0, len(registeredTeams))
+	for _, team := range registeredTeams {
+		if len(team.GetStringSlice(names.Fields.Teams.Players)) == 1 {
+			singlePlayerTeams = append(singlePlayerTeams, team)
+		}
+	}
+
+	if err := dao.ExpandRecords(singlePlayerTeams, []string{names.Fields.Teams.Players + "." + names.Fields.Players.PlayingLevel}, nil); len(err) != 0 {
+		return nil, errors.New("could not expand the players of the teams")
+	}
+
+	return singlePlayerTeams, nil
+}
+
+// Removes the teams from the registrations, draw and seeds of the competition
+func removeTeamsFromCompetition(competition *core.Record, teams []*core.Record) {
+	removedIds := make(map[string]struct{}, len(teams))
+	for _, team := range teams {
+		removedIds[team.Id] = struct{}{}
+	}
+
+	for _, fieldName := range []string{
+		names.Fields.Competitions.Registrations,
+		names.Fields.Competitions.Draw,
+		names.Fields.Competitions.Seeds,
+	} {
+		teamIds := competition.GetStringSlice(fieldName)
+		remainingIds := make([]string, 0, len(teamIds))
+
+		for _, teamId := range teamIds {
+			if _, removed := removedIds[teamId]; !removed {
+				remainingIds = append(remainingIds, teamId)
+			}
+		}
+
+		competition.Set(fieldName, remainingIds)
+	}
+}
+
+// Returns wether the two players can form a team in a competition of the gender category.
+// Players without a gender can only be partnered in non-mixed competitions.
+func doGendersFit(player1 *core.Record, player2 *core.Record, genderCategory string) bool {
+	gender1 := player1.GetString(names.Fields.Players.Gender)
+	gender2 := player2.GetString(names.Fields.Players.Gender)
+
+	switch genderCategory {
+	case "mixed":
+		return gender1 != "" && gender2 != "" && gender1 != gender2
+	case "female", "male":
+		return (gender1 == "" || gender1 == genderCategory) && (gender2 == "" || gender2 == genderCategory)
+	}
+
+	return true
+}
+
+// Returns how well the two players fit as partners. Lower is better.
+// One playing level of difference weighs more than an unfulfilled club preference.
+func partnerCost(player1 *core.Record, player2 *core.Record, clubPreference string) int {
+	cost := 2 * playingLevelDistance(player1, player2)
+
+	sameClub := player1.GetString(names.Fields.Players.Club) != "" &&
+		player1.GetString(names.Fields.Players.Club) == player2.GetString(names.Fields.Players.Club)
+
+	if (clubPreference == "same" && !sameClub) || (clubPreference == "different" && sameClub) {
+		cost += 1
+	}
+
+	return cost
+}
+
+// Returns the difference of the players' playing level indices.
+// A player without a playing level is one level away from any other player.
+func playingLevelDistance(player1 *core.Record, player2 *core.Record) int {
+	level1 := player1.ExpandedOne(names.Fields.Players.PlayingLevel)
+	level2 := player2.ExpandedOne(names.Fields.Players.PlayingLevel)
+
+	if level1 == nil && level2 == nil {
+		return 0
+	}
+	if level1 == nil || level2 == nil {
+		return 1
+	}
+
+	distance := level1.GetInt(names.Fields.PlayingLevels.Index) - level2.GetInt(names.Fields.PlayingLevels.Index)
+	if distance < 0 {
+		return -distance
+	}
+
+	return distance
+}
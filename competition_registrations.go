@@ -1,28 +1,33 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"slices"
+
 	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
 
 	"github.com/pocketbase/pocketbase/core"
 )
 
-// HandleDeletedCompetition deletes the registered teams of a competition that is about to be deleted
-func HandleDeletedCompetition(deletedCompetition *core.Record, dao core.App) error {
-	return dao.RunInTransaction(func(txDao core.App) error {
-		if err := txDao.ExpandRecord(deletedCompetition, []string{names.Fields.Competitions.Registrations}, nil); len(err) != 0 {
-			return err[names.Fields.Competitions.Registrations]
-		}
+// HandleBeforeTeamCreate rejects the creation of a team when registering it for the
+// competition would exceed the tournament's limit of entries per player.
+func HandleBeforeTeamCreate(team *core.Record, competitionId string, dao core.App) error {
+	if competitionId == "" {
+		return nil
+	}
 
-		if err := DeleteRegistrationsOfCompetition(deletedCompetition, txDao); err != nil {
-			return err
-		}
+	competition, err := FetchRecord(names.Collections.Competitions, competitionId, dao)
+	if err != nil {
+		return err
+	}
 
-		return nil
-	})
+	return validatePlayerEntries(team, competition, dao)
 }
 
 // HandleCreatedTeam adds a newly created team to a competition's registrations list.
-// Also deletes double registrations.
+// When the competition has reached its maximum number of entries, the team is put
+// on the waitlist instead. Also deletes double registrations.
 func HandleCreatedTeam(createdTeam *core.Record, competitionId string, dao core.App) error {
 	if competitionId == "" {
 		return nil
@@ -34,51 +39,125 @@ func HandleCreatedTeam(createdTeam *core.Record, competitionId string, dao core.
 			return err
 		}
 
-		if err := deleteDoubleRegistrations(createdTeam, competition, txDao); err != nil {
-			return err
+		if err := txDao.ExpandRecord(competition, []string{names.Fields.Competitions.Registrations}, nil); len(err) != 0 {
+			return err[names.Fields.Competitions.Registrations]
 		}
+		registeredTeams := competition.ExpandedAll(names.Fields.Competitions.Registrations)
 
-		newRegistrations := append(
-			competition.GetStringSlice(names.Fields.Competitions.Registrations),
-			createdTeam.Id,
-		)
+		// A team that replaces a double registration takes over its place
+		numRegistrations := len(registeredTeams) - len(findDoubleRegisteredTeams(registeredTeams, createdTeam))
+		maxEntries := competition.GetInt(names.Fields.Competitions.MaxEntries)
 
-		competition.Set(names.Fields.Competitions.Registrations, newRegistrations)
+		teamList := names.Fields.Competitions.Registrations
+		if maxEntries > 0 && numRegistrations >= maxEntries {
+			teamList = names.Fields.Competitions.Waitlist
+		}
+
+		competition.Set(teamList, append(competition.GetStringSlice(teamList), createdTeam.Id))
 
 		if err := txDao.Save(competition); err != nil {
 			return err
 		}
 
+		// The double registrations are deleted after the new team took their
+		// place so that no waitlisted team moves up into it.
+		if err := deleteDoubleRegistrations(createdTeam, competition, txDao); err != nil {
+			return err
+		}
+
 		return nil
 	})
 }
 
-// HandleAfterUpdatedTeam checks if a team update caused the team to be empty
-// and deletes it. Other updates are cascaded to the competition that the team
-// is registered for.
-func HandleAfterUpdatedTeam(updatedTeam *core.Record, dao core.App) error {
-	if len(updatedTeam.GetStringSlice(names.Fields.Teams.Players)) == 0 {
-		if err := dao.Delete(updatedTeam); err != nil {
-			return err
+// HandleAfterUpdatedCompetition moves teams up from the waitlist when the competition
+// has free places. This happens when a team withdraws or when the maximum number of
+// entries is raised. Waitlisted teams with a player that is already registered or
+// that would exceed the entry limits of a player are skipped. Running competitions
+// are not changed.
+func HandleAfterUpdatedCompetition(updatedCompetition *core.Record, dao core.App) error {
+	competition := WrapRecord[Competition](updatedCompetition)
+
+	if len(competition.WaitlistIds()) == 0 || !competition.HasFreePlace() || competition.IsRunning() {
+		return nil
+	}
+
+	return dao.RunInTransaction(func(txDao core.App) error {
+		if err := txDao.ExpandRecord(
+			updatedCompetition,
+			[]string{names.Fields.Competitions.Registrations, names.Fields.Competitions.Waitlist},
+			nil,
+		); len(err) != 0 {
+			return errors.New("could not expand the teams of the competition")
 		}
-	} else {
-		competitions, err := FindReverseMultiRelations(updatedTeam.Id, names.Collections.Competitions, names.Fields.Competitions.Registrations, dao)
-		if err != nil {
+
+		promoted, err := promoteWaitlistedTeams(competition, func(team *Team) error {
+			return validatePlayerEntries(team.ProxyRecord(), updatedCompetition, txDao)
+		})
+		if err != nil || !promoted {
 			return err
 		}
 
-		if err := CascadeRelationUpdate(competitions, dao); err != nil {
-			return err
+		return txDao.Save(competition)
+	})
+}
+
+// Moves the waitlisted teams of the competition into its free places in the order of the
+// waitlist. Teams that share a player with a registered team or that validateEntries
+// rejects with an entry limit error stay on the waitlist.
+// The registrations and waitlist need to be expanded. Returns wether a team was moved.
+func promoteWaitlistedTeams(competition *Competition, validateEntries func(team *Team) error) (bool, error) {
+	registeredTeams := competition.Registrations()
+	waitlistedTeams := competition.Waitlist()
+
+	registrations := competition.RegistrationIds()
+	remainingWaitlist := make([]string, 0, len(waitlistedTeams))
+
+	for _, team := range waitlistedTeams {
+		isFull := competition.MaxEntries() > 0 && len(registrations) >= competition.MaxEntries()
+
+		if isFull || slices.ContainsFunc(registeredTeams, team.SharesPlayerWith) {
+			remainingWaitlist = append(remainingWaitlist, team.Id)
+			continue
+		}
+
+		if err := validateEntries(team); err != nil {
+			if !isEntryLimitError(err) {
+				return false, err
+			}
+
+			remainingWaitlist = append(remainingWaitlist, team.Id)
+			continue
 		}
+
+		registeredTeams = append(registeredTeams, team)
+		registrations = append(registrations, team.Id)
 	}
 
-	return nil
+	if len(remainingWaitlist) == len(waitlistedTeams) {
+		return false, nil
+	}
+
+	competition.SetRegistrationIds(registrations)
+	competition.SetWaitlistIds(remainingWaitlist)
+
+	return true, nil
+}
+
+// Returns wether the error is a rejection by validatePlayerEntries
+func isEntryLimitError(err error) bool {
+	var apiErr *ApiError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	return apiErr.Code == ErrorCodeDisciplineAlreadyEntered || apiErr.Code == ErrorCodeMaxEntriesExceeded
 }
 
 // HandleUpdatedTeam removes a team from its competition's draw when the
 // update caused the team to have less members than the competition's team
 // size requires.
-// Also deletes double registrations that emerge from the update.
+// Also deletes double registrations that emerge from the update and rejects
+// updates that exceed the tournament's limit of entries per player.
 func HandleUpdatedTeam(updatedTeam *core.Record, dao core.App) error {
 	teamSize := len(updatedTeam.GetStringSlice(names.Fields.Teams.Players))
 
@@ -97,6 +176,10 @@ func HandleUpdatedTeam(updatedTeam *core.Record, dao core.App) error {
 			return nil
 		}
 
+		if err := validatePlayerEntries(updatedTeam, competition, txDao); err != nil {
+			return err
+		}
+
 		if err := deleteDoubleRegistrations(updatedTeam, competition, txDao); err != nil {
 			return err
 		}
@@ -136,67 +219,139 @@ func HandleUpdatedTeam(updatedTeam *core.Record, dao core.App) error {
 
 }
 
-// Deletes the given competition and the teams that are registered to it
-func DeleteCompetitionAndTeams(competition *core.Record, dao core.App) error {
-	return dao.RunInTransaction(func(txDao core.App) error {
-		if err := txDao.Delete(competition); err != nil {
+// Deletes teams that are registered or waitlisted in the competition and contain a member of the given team
+func deleteDoubleRegistrations(team *core.Record, competition *core.Record, dao core.App) error {
+	if err := dao.ExpandRecord(
+		competition,
+		[]string{names.Fields.Competitions.Registrations, names.Fields.Competitions.Waitlist},
+		nil,
+	); len(err) != 0 {
+		return errors.New("could not expand the teams of the competition")
+	}
+	enteredTeams := append(
+		competition.ExpandedAll(names.Fields.Competitions.Registrations),
+		competition.ExpandedAll(names.Fields.Competitions.Waitlist)...,
+	)
+
+	doubleRegisteredTeams := findDoubleRegisteredTeams(enteredTeams, team)
+
+	if err := ProcessAsModels(doubleRegisteredTeams, dao.Delete); err != nil {
+		return err
+	}
+
+	if len(doubleRegisteredTeams) != 0 {
+		updatedCompetition, err := dao.FindRecordById(names.Collections.Competitions, competition.Id)
+		if err != nil {
 			return err
 		}
+		*competition = *updatedCompetition
+	}
 
-		if err := DeleteRegistrationsOfCompetition(competition, txDao); err != nil {
+	return nil
+}
+
+// Checks that registering the team for the competition does not enter any of its players
+// into more competitions than the tournament allows or into two competitions of the
+// same discipline (e.g. men's singles in two different age groups).
+//
+// The competitions with the sameDisciplineIds are allowed to share the discipline of the
+// competition. They still count as entries, like the source competition of a clone.
+func validatePlayerEntries(team *core.Record, competition *core.Record, dao core.App, sameDisciplineIds ...string) error {
+	tournament, err := FindTournament(dao)
+	if err != nil {
+		return err
+	}
+
+	maxEntries := tournament.MaxEntriesPerPlayer()
+	discipline := GroupOfCompetition(competition, "")
+
+	for _, playerId := range team.GetStringSlice(names.Fields.Teams.Players) {
+		competitionsOfPlayer, err := findCompetitionsOfPlayer(playerId, dao)
+		if err != nil {
 			return err
 		}
 
-		return nil
-	})
+		// The competition that the team is entering counts as one entry
+		numEntries := 1
 
-}
+		for _, otherCompetition := range competitionsOfPlayer {
+			if otherCompetition.Id == competition.Id {
+				continue
+			}
 
-func DeleteRegistrationsOfCompetition(competition *core.Record, dao core.App) error {
-	registrations := competition.ExpandedAll(names.Fields.Competitions.Registrations)
+			if !slices.Contains(sameDisciplineIds, otherCompetition.Id) && GroupOfCompetition(otherCompetition, "") == discipline {
+				return rejectedError(ErrorCodeDisciplineAlreadyEntered, "a player is already registered for a competition of the same discipline").
+					WithDetail(names.Fields.Teams.Players, FieldErrorCodeInvalid, fmt.Sprintf("player %s is already registered for a competition of the same discipline", playerId))
+			}
 
-	if err := ProcessAsModels(registrations, dao.Delete); err != nil {
-		return err
+			numEntries += 1
+		}
+
+		if maxEntries > 0 && numEntries > maxEntries {
+			return rejectedError(ErrorCodeMaxEntriesExceeded, "a player has reached the maximum number of entries").
+				WithDetail(names.Fields.Teams.Players, FieldErrorCodeInvalid, fmt.Sprintf("player %s cannot be registered for more than %d competitions", playerId, maxEntries))
+		}
 	}
 
 	return nil
 }
 
-// Deletes teams that are registered to the competition and contain a member of the given team
-func deleteDoubleRegistrations(team *core.Record, competition *core.Record, dao core.App) error {
-	if err := dao.ExpandRecord(competition, []string{names.Fields.Competitions.Registrations}, nil); len(err) != 0 {
-		return err[names.Fields.Competitions.Registrations]
+// Returns all competitions that the player is registered or waitlisted for with any team
+func findCompetitionsOfPlayer(playerId string, dao core.App) ([]*core.Record, error) {
+	teamsOfPlayer, err := FindReverseMultiRelations(playerId, names.Collections.Teams, names.Fields.Teams.Players, dao)
+	if err != nil {
+		return nil, err
 	}
-	registeredTeams := competition.ExpandedAll(names.Fields.Competitions.Registrations)
 
-	doubleRegisteredTeams := findDoubleRegisteredTeams(registeredTeams, team)
+	competitionsOfPlayer := make([]*core.Record, 0, len(teamsOfPlayer))
+	competitionIds := make(map[string]struct{}, len(teamsOfPlayer))
 
-	if err := ProcessAsModels(doubleRegisteredTeams, dao.Delete); err != nil {
-		return err
-	}
-
-	if len(doubleRegisteredTeams) != 0 {
-		updatedCompetition, err := dao.FindRecordById(names.Collections.Competitions, competition.Id)
+	for _, team := range teamsOfPlayer {
+		competitions, err := findCompetitionsOfTeam(team.Id, dao)
 		if err != nil {
-			return err
+			return nil, err
+		}
+
+		for _, competition := range competitions {
+			if _, exists := competitionIds[competition.Id]; exists {
+				continue
+			}
+			competitionIds[competition.Id] = struct{}{}
+			competitionsOfPlayer = append(competitionsOfPlayer, competition)
 		}
-		*competition = *updatedCompetition
 	}
 
-	return nil
+	return competitionsOfPlayer, nil
 }
 
+// Returns the competition that the team is registered or waitlisted for or nil if there is none
 func findCompetitionOfTeam(teamId string, dao core.App) (*core.Record, error) {
-	reverseRelations, err := FindReverseMultiRelations(teamId, names.Collections.Competitions, names.Fields.Competitions.Registrations, dao)
+	competitions, err := findCompetitionsOfTeam(teamId, dao)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(reverseRelations) == 0 {
+	if len(competitions) == 0 {
 		return nil, nil
 	}
 
-	return reverseRelations[0], nil
+	return competitions[0], nil
+}
+
+// Returns the competitions that list the team in their registrations or waitlist
+func findCompetitionsOfTeam(teamId string, dao core.App) ([]*core.Record, error) {
+	competitions := []*core.Record{}
+
+	for _, fieldName := range []string{names.Fields.Competitions.Registrations, names.Fields.Competitions.Waitlist} {
+		reverseRelations, err := FindReverseMultiRelations(teamId, names.Collections.Competitions, fieldName, dao)
+		if err != nil {
+			return nil, err
+		}
+
+		competitions = append(competitions, reverseRelations...)
+	}
+
+	return competitions, nil
 }
 
 func findDoubleRegisteredTeams(teams []*core.Record, newTeam *core.Record) []*core.Record {
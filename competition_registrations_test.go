@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestPromoteWaitlistedTeams(t *testing.T) {
+	acceptAll := func(team *Team) error { return nil }
+
+	scenarios := []struct {
+		name                  string
+		maxEntries            int
+		registrations         []*Team
+		waitlist              []*Team
+		validateEntries       func(team *Team) error
+		expectedPromoted      bool
+		expectedRegistrations []string
+		expectedWaitlist      []string
+	}{
+		{
+			name:                  "promotes in the order of the waitlist",
+			maxEntries:            2,
+			registrations:         []*Team{newTestTeam("r1", "p1")},
+			waitlist:              []*Team{newTestTeam("w1", "p2"), newTestTeam("w2", "p3")},
+			validateEntries:       acceptAll,
+			expectedPromoted:      true,
+			expectedRegistrations: []string{"r1", "w1"},
+			expectedWaitlist:      []string{"w2"},
+		},
+		{
+			name:                  "unlimited entries promote the whole waitlist",
+			maxEntries:            0,
+			registrations:         []*Team{newTestTeam("r1", "p1")},
+			waitlist:              []*Team{newTestTeam("w1", "p2"), newTestTeam("w2", "p3")},
+			validateEntries:       acceptAll,
+			expectedPromoted:      true,
+			expectedRegistrations: []string{"r1", "w1", "w2"},
+			expectedWaitlist:      []string{},
+		},
+		{
+			name:                  "full competition",
+			maxEntries:            1,
+			registrations:         []*Team{newTestTeam("r1", "p1")},
+			waitlist:              []*Team{newTestTeam("w1", "p2")},
+			validateEntries:       acceptAll,
+			expectedPromoted:      false,
+			expectedRegistrations: []string{"r1"},
+			expectedWaitlist:      []string{"w1"},
+		},
+		{
+			name:                  "skips teams that share a player with a registered team",
+			maxEntries:            2,
+			registrations:         []*Team{newTestTeam("r1", "p1", "p2")},
+			waitlist:              []*Team{newTestTeam("w1", "p2", "p3"), newTestTeam("w2", "p4", "p5")},
+			validateEntries:       acceptAll,
+			expectedPromoted:      true,
+			expectedRegistrations: []string{"r1", "w2"},
+			expectedWaitlist:      []string{"w1"},
+		},
+		{
+			name:                  "skips teams that share a player with a promoted team",
+			maxEntries:            0,
+			registrations:         []*Team{},
+			waitlist:              []*Team{newTestTeam("w1", "p1", "p2"), newTestTeam("w2", "p2", "p3")},
+			validateEntries:       acceptAll,
+			expectedPromoted:      true,
+			expectedRegistrations: []string{"w1"},
+			expectedWaitlist:      []string{"w2"},
+		},
+		{
+			name:          "skips teams that exceed an entry limit",
+			maxEntries:    2,
+			registrations: []*Team{newTestTeam("r1", "p1")},
+			waitlist:      []*Team{newTestTeam("w1", "p2"), newTestTeam("w2", "p3")},
+			validateEntries: func(team *Team) error {
+				if team.Id == "w1" {
+					return rejectedError(ErrorCodeMaxEntriesExceeded, "")
+				}
+				return nil
+			},
+			expectedPromoted:      true,
+			expectedRegistrations: []string{"r1", "w2"},
+			expectedWaitlist:      []string{"w1"},
+		},
+		{
+			name:          "nothing to promote",
+			maxEntries:    2,
+			registrations: []*Team{newTestTeam("r1", "p1")},
+			waitlist:      []*Team{newTestTeam("w1", "p2")},
+			validateEntries: func(team *Team) error {
+				return rejectedError(ErrorCodeDisciplineAlreadyEntered, "")
+			},
+			expectedPromoted:      false,
+			expectedRegistrations: []string{"r1"},
+			expectedWaitlist:      []string{"w1"},
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			competition := newTestCompetition(s.maxEntries, s.registrations, s.waitlist)
+
+			promoted, err := promoteWaitlistedTeams(competition, s.validateEntries)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if promoted != s.expectedPromoted {
+				t.Fatalf("expected promoted to be %v, got %v", s.expectedPromoted, promoted)
+			}
+			if registrations := competition.RegistrationIds(); !slices.Equal(registrations, s.expectedRegistrations) {
+				t.Fatalf("expected the registrations %v, got %v", s.expectedRegistrations, registrations)
+			}
+			if waitlist := competition.WaitlistIds(); !slices.Equal(waitlist, s.expectedWaitlist) {
+				t.Fatalf("expected the waitlist %v, got %v", s.expectedWaitlist, waitlist)
+			}
+		})
+	}
+}
+
+func TestPromoteWaitlistedTeamsValidationError(t *testing.T) {
+	validationErr := errors.New("could not fetch the entries")
+
+	competition := newTestCompetition(
+		0,
+		[]*Team{newTestTeam("r1", "p1")},
+		[]*Team{newTestTeam("w1", "p2")},
+	)
+
+	promoted, err := promoteWaitlistedTeams(competition, func(team *Team) error { return validationErr })
+	if !errors.Is(err, validationErr) {
+		t.Fatalf("expected the validation error, got %v", err)
+	}
+	if promoted {
+		t.Fatal("expected no promotion")
+	}
+	if waitlist := competition.WaitlistIds(); !slices.Equal(waitlist, []string{"w1"}) {
+		t.Fatalf("expected the waitlist to be unchanged, got %v", waitlist)
+	}
+}
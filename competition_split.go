@@ -0,0 +1,335 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// The outcome of splitting a competition
+type CompetitionSplit struct {
+	// The IDs of the split competitions mapped by the ID of their category
+	Competitions map[string]string
+
+	// The teams that could not be placed into one of the categories. When there are
+	// any, the split is not carried out.
+	UnplacedTeams []string
+}
+
+// PostCompetitionSplit handles POST requests to the /api/ezbadminton/competitions/split route.
+// It splits the competition into one competition for each of the given categories
+// (age groups or playing levels). The optional placements map team IDs to the category
+// that they are put into regardless of their eligibility.
+// The If-Match header can give the expected revision of the competition.
+func PostCompetitionSplit(e *core.RequestEvent, dao core.App) error {
+	body := struct {
+		Competition string
+		Categories  []string
+		Placements  map[string]string
+	}{}
+
+	if err := e.BindBody(&body); err != nil {
+		return RespondError(e, invalidBodyError())
+	}
+	if body.Competition == "" {
+		return RespondError(e, missingFieldError("competition"))
+	}
+
+	var split *CompetitionSplit
+
+	err := dao.RunInTransaction(func(txDao core.App) error {
+		competition, err := FetchRecord(names.Collections.Competitions, body.Competition, txDao)
+		if err != nil {
+			return err
+		}
+		if err := checkRevision(e, competition); err != nil {
+			return err
+		}
+
+		split, err = SplitCompetition(body.Competition, body.Categories, body.Placements, txDao)
+		return err
+	})
+	if err != nil {
+		return RespondError(e, err)
+	}
+
+	return e.JSON(http.StatusOK, split)
+}
+
+// SplitCompetition distributes the registered and waitlisted teams of the competition
+// into one competition per category. Each team is placed into the category that all of its
+// players are eligible for. Players are eligible for the playing level that they have and for
+// the age groups that their age fits. Of multiple fitting age groups the narrowest is chosen.
+//
+// The competition itself becomes the competition of its current category when that is
+// one of the split categories and of the first category otherwise. The other competitions
+// are created with a copy of its tournament mode settings.
+func SplitCompetition(
+	competitionId string,
+	categoryIds []string,
+	placements map[string]string,
+	dao core.App,
+) (*CompetitionSplit, error) {
+	split := &CompetitionSplit{
+		Competitions:  map[string]string{},
+		UnplacedTeams: []string{},
+	}
+
+	err := dao.RunInTransaction(func(txDao core.App) error {
+		competition, err := FetchRecord(names.Collections.Competitions, competitionId, txDao)
+		if err != nil {
+			return err
+		}
+
+		if len(competition.GetStringSlice(names.Fields.Competitions.Matches)) != 0 {
+			return rejectedError(ErrorCodeCompetitionAlreadyRunning, "cannot split a running competition")
+		}
+
+		categories, err := fetchSplitCategories(categoryIds, txDao)
+		if err != nil {
+			return err
+		}
+
+		categoryType := getTypeOfCategory(categories[0])
+
+		tournament, err := FetchTournament(txDao)
+		if err != nil {
+			return err
+		}
+		if !tournament.GetBool(getOptionNameOfCategory(categories[0])) {
+			return rejectedError(ErrorCodeCategorizationMismatch, "the categorization of the split categories is not enabled")
+		}
+
+		if err := validateSplitCategoriesAreFree(competition, categories, txDao); err != nil {
+			return err
+		}
+
+		teamLists := []string{names.Fields.Competitions.Registrations, names.Fields.Competitions.Waitlist}
+		if err := txDao.ExpandRecord(competition, teamLists, nil); len(err) != 0 {
+			return errors.New("could not expand the teams of the competition")
+		}
+
+		// The team lists of each split category
+		splitTeamLists := make(map[string]map[string][]string, len(categories))
+		for _, category := range categories {
+			splitTeamLists[category.Id] = map[string][]string{}
+		}
+
+		for _, teamList := range teamLists {
+			teams := competition.ExpandedAll(teamList)
+
+			if err := txDao.ExpandRecords(teams, []string{names.Fields.Teams.Players}, nil); len(err) != 0 {
+				return errors.New("could not expand the players of the teams")
+			}
+
+			for _, team := range teams {
+				category := findSplitCategory(team, categories, placements)
+				if category == nil {
+					split.UnplacedTeams = append(split.UnplacedTeams, team.Id)
+					continue
+				}
+
+				splitTeamLists[category.Id][teamList] = append(splitTeamLists[category.Id][teamList], team.Id)
+			}
+		}
+
+		if len(split.UnplacedTeams) != 0 {
+			return nil
+		}
+
+		retainedCategory := categories[0]
+		for _, category := range categories {
+			if competition.GetString(categoryType) == category.Id {
+				retainedCategory = category
+			}
+		}
+
+		for _, category := range categories {
+			splitCompetition := competition
+			if category != retainedCategory {
+				splitCompetition, err = copyCompetition(competition, txDao)
+				if err != nil {
+					return err
+				}
+			}
+
+			splitCompetition.Set(categoryType, category.Id)
+			splitCompetition.Set(names.Fields.Competitions.Registrations, splitTeamLists[category.Id][names.Fields.Competitions.Registrations])
+			splitCompetition.Set(names.Fields.Competitions.Waitlist, splitTeamLists[category.Id][names.Fields.Competitions.Waitlist])
+			// The draw and seeds have to be made anew with the changed registrations
+			splitCompetition.Set(names.Fields.Competitions.Draw, nil)
+			splitCompetition.Set(names.Fields.Competitions.Seeds, nil)
+
+			if err := txDao.Save(splitCompetition); err != nil {
+				return err
+			}
+
+			split.Competitions[category.Id] = splitCompetition.Id
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return split, nil
+}
+
+// Fetches the categories of a split. They have to be at least two distinct
+// categories of the same collection (either age groups or playing levels).
+func fetchSplitCategories(categoryIds []string, dao core.App) ([]*core.Record, error) {
+	if len(categoryIds) < 2 {
+		return nil, rejectedError(ErrorCodeInvalidSplit, "the split is invalid").
+			WithDetail("categories", FieldErrorCodeInvalid, "a competition has to be split into at least two categories")
+	}
+
+	categoryCollection := names.Collections.AgeGroups
+	if _, err := dao.FindRecordById(categoryCollection, categoryIds[0]); err != nil {
+		categoryCollection = names.Collections.PlayingLevels
+	}
+
+	categories, err := dao.FindRecordsByIds(categoryCollection, categoryIds)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(categories) != len(categoryIds) {
+		return nil, rejectedError(ErrorCodeInvalidSplit, "the split is invalid").
+			WithDetail("categories", FieldErrorCodeInvalid, "the split categories have to be distinct categories of the same categorization")
+	}
+
+	// Keep the order of the request
+	slices.SortFunc(categories, func(a, b *core.Record) int {
+		return slices.Index(categoryIds, a.Id) - slices.Index(categoryIds, b.Id)
+	})
+
+	return categories, nil
+}
+
+// Returns an error when there already is a competition of the same discipline in one of the
+// split categories. The competition that is split is excluded.
+func validateSplitCategoriesAreFree(competition *core.Record, categories []*core.Record, dao core.App) error {
+	competitions, err := FetchAndExpandCollection(
+		names.Collections.Competitions,
+		[]string{names.Fields.Competitions.AgeGroup, names.Fields.Competitions.PlayingLevel},
+		dao,
+	)
+	if err != nil {
+		return err
+	}
+
+	categoryType := getTypeOfCategory(categories[0])
+	otherCategorization := getInvertedTypeOfCategory(categories[0])
+
+	var splitGroup CompetitionGroup
+	for _, other := range competitions {
+		if other.Id == competition.Id {
+			splitGroup = GroupOfCompetition(other, otherCategorization)
+		}
+	}
+
+	for _, other := range competitions {
+		if other.Id == competition.Id || GroupOfCompetition(other, otherCategorization) != splitGroup {
+			continue
+		}
+
+		for _, category := range categories {
+			if other.GetString(categoryType) == category.Id {
+				return rejectedError(ErrorCodeCompetitionAlreadyExists, "there already is a competition of the same discipline in one of the split categories").
+					WithDetail("categories", FieldErrorCodeInvalid, category.Id+" already has a competition of the same discipline")
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns the category that the team is placed into or nil if there is none that fits.
+// The players of the team have to be expanded.
+func findSplitCategory(team *core.Record, categories []*core.Record, placements map[string]string) *core.Record {
+	if categoryId, placed := placements[team.Id]; placed {
+		for _, category := range categories {
+			if category.Id == categoryId {
+				return category
+			}
+		}
+	}
+
+	players := team.ExpandedAll(names.Fields.Teams.Players)
+	if len(players) == 0 {
+		return nil
+	}
+
+	var fittingCategory *core.Record
+
+	for _, category := range categories {
+		fitsAll := true
+		for _, player := range players {
+			if !isPlayerEligible(player, category) {
+				fitsAll = false
+				break
+			}
+		}
+
+		if fitsAll && (fittingCategory == nil || isNarrowerAgeGroup(category, fittingCategory)) {
+			fittingCategory = category
+		}
+	}
+
+	return fittingCategory
+}
+
+// Returns wether the player is eligible for the category (age group or playing level).
+// Players without a playing level or a date of birth are not eligible.
+func isPlayerEligible(player *core.Record, category *core.Record) bool {
+	switch category.Collection().Name {
+	case names.Collections.PlayingLevels:
+		return player.GetString(names.Fields.Players.PlayingLevel) == category.Id
+	case names.Collections.AgeGroups:
+		dateOfBirth := player.GetDateTime(names.Fields.Players.DateOfBirth)
+		if dateOfBirth.IsZero() {
+			return false
+		}
+
+		// The age that the player reaches in the current year
+		age := time.Now().Year() - dateOfBirth.Time().Year()
+		ageLimit := category.GetInt(names.Fields.AgeGroups.Age)
+
+		switch category.GetString(names.Fields.AgeGroups.Type) {
+		case "under":
+			return age < ageLimit
+		case "over":
+			return age >= ageLimit
+		}
+	}
+
+	return false
+}
+
+// Returns wether the age group a admits fewer ages than the age group b.
+// Playing levels are never narrower than each other.
+func isNarrowerAgeGroup(a *core.Record, b *core.Record) bool {
+	if a.Collection().Name != names.Collections.AgeGroups {
+		return false
+	}
+
+	typeA := a.GetString(names.Fields.AgeGroups.Type)
+	if typeA != b.GetString(names.Fields.AgeGroups.Type) {
+		return false
+	}
+
+	switch typeA {
+	case "under":
+		return a.GetInt(names.Fields.AgeGroups.Age) < b.GetInt(names.Fields.AgeGroups.Age)
+	case "over":
+		return a.GetInt(names.Fields.AgeGroups.Age) > b.GetInt(names.Fields.AgeGroups.Age)
+	}
+
+	return false
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// A competition of a competition template. The categories are given by their name ("U15", "O35"
+// or the name of a playing level) so that a template can be used in any tournament.
+type CompetitionTemplateEntry struct {
+	GenderCategory string
+	TeamSize       int
+	AgeGroup       string
+	PlayingLevel   string
+	MaxEntries     int
+
+	// The field values of the tournament mode settings
+	TournamentModeSettings map[string]any
+}
+
+// The discipline and categories that make a competition unique
+type competitionSetup struct {
+	GenderCategory string
+	TeamSize       int
+	AgeGroup       string
+	PlayingLevel   string
+}
+
+// PostApplyCompetitionTemplate handles POST requests to the /api/ezbadminton/competition_templates/apply route.
+// It creates the competitions of the given template and responds with them.
+func PostApplyCompetitionTemplate(e *core.RequestEvent, dao core.App) error {
+	body := struct {
+		Template string
+	}{}
+
+	if err := e.BindBody(&body); err != nil {
+		return RespondError(e, invalidBodyError())
+	}
+	if body.Template == "" {
+		return RespondError(e, missingFieldError("template"))
+	}
+
+	template, err := FetchRecord(names.Collections.CompetitionTemplates, body.Template, dao)
+	if err != nil {
+		return RespondError(e, err)
+	}
+
+	competitions, err := ApplyCompetitionTemplate(template, dao)
+	if err != nil {
+		return RespondError(e, err)
+	}
+
+	return e.JSON(http.StatusOK, competitions)
+}
+
+// PostCompetitionTemplate handles POST requests to the /api/ezbadminton/competition_templates/from-competitions route.
+// It stores the setup of the given competitions as a new template with the given name
+// and responds with the template.
+func PostCompetitionTemplate(e *core.RequestEvent, dao core.App) error {
+	body := struct {
+		Name         string
+		Competitions []string
+	}{}
+
+	if err := e.BindBody(&body); err != nil {
+		return RespondError(e, invalidBodyError())
+	}
+	if body.Name == "" {
+		return RespondError(e, missingFieldError("name"))
+	}
+	if len(body.Competitions) == 0 {
+		return RespondError(e, missingFieldError("competitions"))
+	}
+
+	template, err := CreateCompetitionTemplate(body.Name, body.Competitions, dao)
+	if err != nil {
+		return RespondError(e, err)
+	}
+
+	return e.JSON(http.StatusOK, template)
+}
+
+// ApplyCompetitionTemplate creates the competitions of the template with new tournament mode settings.
+// The categories of the template have to exist and fit the categorizations that the tournament uses.
+// No competition is created when one of them already exists.
+func ApplyCompetitionTemplate(template *core.Record, dao core.App) ([]*core.Record, error) {
+	entries := []CompetitionTemplateEntry{}
+	if err := template.UnmarshalJSONField(names.Fields.CompetitionTemplates.Competitions, &entries); err != nil {
+		return nil, err
+	}
+
+	createdCompetitions := make([]*core.Record, 0, len(entries))
+
+	err := dao.RunInTransaction(func(txDao core.App) error {
+		tournament, err := FetchTournament(txDao)
+		if err != nil {
+			return err
+		}
+		ageGroups, err := FetchCollection(names.Collections.AgeGroups, txDao)
+		if err != nil {
+			return err
+		}
+		playingLevels, err := FetchCollection(names.Collections.PlayingLevels, txDao)
+		if err != nil {
+			return err
+		}
+		competitions, err := FetchCollection(names.Collections.Competitions, txDao)
+		if err != nil {
+			return err
+		}
+
+		existingSetups := make(map[competitionSetup]struct{}, len(competitions))
+		for _, competition := range competitions {
+			existingSetups[setupOfCompetition(competition)] = struct{}{}
+		}
+
+		competitionCollection, err := txDao.FindCollectionByNameOrId(names.Collections.Competitions)
+		if err != nil {
+			return err
+		}
+		settingsCollection, err := txDao.FindCollectionByNameOrId(names.Collections.TournamentModeSettings)
+		if err != nil {
+			return err
+		}
+
+		for i, entry := range entries {
+			ageGroup, err := findTemplateCategory(
+				entry.AgeGroup,
+				fmt.Sprintf("competitions.%d.ageGroup", i),
+				tournament.GetBool(names.Fields.Tournaments.UseAgeGroups),
+				func(name string) *core.Record { return findAgeGroupByName(ageGroups, name) },
+			)
+			if err != nil {
+				return err
+			}
+			playingLevel, err := findTemplateCategory(
+				entry.PlayingLevel,
+				fmt.Sprintf("competitions.%d.playingLevel", i),
+				tournament.GetBool(names.Fields.Tournaments.UsePlayingLevels),
+				func(name string) *core.Record { return findPlayingLevelByName(playingLevels, name) },
+			)
+			if err != nil {
+				return err
+			}
+
+			competition := core.NewRecord(competitionCollection)
+			competition.Set(names.Fields.Competitions.GenderCategory, entry.GenderCategory)
+			competition.Set(names.Fields.Competitions.TeamSize, entry.TeamSize)
+			competition.Set(names.Fields.Competitions.AgeGroup, ageGroup)
+			competition.Set(names.Fields.Competitions.PlayingLevel, playingLevel)
+			competition.Set(names.Fields.Competitions.MaxEntries, entry.MaxEntries)
+
+			setup := setupOfCompetition(competition)
+			if _, exists := existingSetups[setup]; exists {
+				return rejectedError(ErrorCodeCompetitionAlreadyExists, "a competition of the template already exists").
+					WithDetail(fmt.Sprintf("competitions.%d", i), FieldErrorCodeInvalid, "the competition already exists")
+			}
+			existingSetups[setup] = struct{}{}
+
+			if entry.TournamentModeSettings != nil {
+				settings := core.NewRecord(settingsCollection)
+				for fieldName, value := range entry.TournamentModeSettings {
+					settings.Set(fieldName, value)
+				}
+				if err := txDao.Save(settings); err != nil {
+					return err
+				}
+				competition.Set(names.Fields.Competitions.TournamentModeSettings, settings.Id)
+			}
+
+			if err := txDao.Save(competition); err != nil {
+				return err
+			}
+
+			createdCompetitions = append(createdCompetitions, competition)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return createdCompetitions, nil
+}
+
+// CreateCompetitionTemplate saves a template of the given competitions. Their registrations are not part of it.
+func CreateCompetitionTemplate(name string, competitionIds []string, dao core.App) (*core.Record, error) {
+	templateCollection, err := dao.FindCollectionByNameOrId(names.Collections.CompetitionTemplates)
+	if err != nil {
+		return nil, err
+	}
+
+	competitions, err := dao.FindRecordsByIds(names.Collections.Competitions, competitionIds)
+	if err != nil {
+		return nil, err
+	}
+	if len(competitions) != len(competitionIds) {
+		return nil, NewApiError(http.StatusNotFound, ErrorCodeCompetitionNotFound, "not all competitions of the template exist").
+			WithDetail("competitions", FieldErrorCodeInvalid, "the competitions have to be distinct existing competitions")
+	}
+
+	expandedFields := []string{
+		names.Fields.Competitions.AgeGroup,
+		names.Fields.Competitions.PlayingLevel,
+		names.Fields.Competitions.TournamentModeSettings,
+	}
+	if err := dao.ExpandRecords(competitions, expandedFields, nil); len(err) != 0 {
+		return nil, errors.New("could not expand the categories and settings of the competitions")
+	}
+
+	entries := make([]CompetitionTemplateEntry, 0, len(competitions))
+
+	for _, competition := range competitions {
+		entry := CompetitionTemplateEntry{
+			GenderCategory: competition.GetString(names.Fields.Competitions.GenderCategory),
+			TeamSize:       competition.GetInt(names.Fields.Competitions.TeamSize),
+			MaxEntries:     competition.GetInt(names.Fields.Competitions.MaxEntries),
+		}
+
+		if ageGroup := competition.ExpandedOne(names.Fields.Competitions.AgeGroup); ageGroup != nil {
+			entry.AgeGroup = ageGroupName(ageGroup)
+		}
+		if playingLevel := competition.ExpandedOne(names.Fields.Competitions.PlayingLevel); playingLevel != nil {
+			entry.PlayingLevel = playingLevel.GetString(names.Fields.PlayingLevels.Name)
+		}
+
+		if settings := competition.ExpandedOne(names.Fields.Competitions.TournamentModeSettings); settings != nil {
+			entry.TournamentModeSettings = map[string]any{}
+			for _, field := range settings.Collection().Fields {
+				if field.GetName() == core.FieldNameId || field.Type() == core.FieldTypeAutodate {
+					continue
+				}
+				entry.TournamentModeSettings[field.GetName()] = settings.Get(field.GetName())
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	template := core.NewRecord(templateCollection)
+	template.Set(names.Fields.CompetitionTemplates.Name, name)
+	template.Set(names.Fields.CompetitionTemplates.Competitions, entries)
+
+	if err := dao.Save(template); err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+// Returns the ID of the category with the given name. A category is required when the tournament
+// uses the categorization and not allowed otherwise. The ID is empty when there is no category.
+// Errors are reported as errors of the given template field.
+func findTemplateCategory(
+	name string,
+	field string,
+	useCategorization bool,
+	findByName func(name string) *core.Record,
+) (string, error) {
+	if !useCategorization {
+		if name != "" {
+			return "", rejectedError(ErrorCodeCategorizationMismatch, "the template does not fit the categorizations of the tournament").
+				WithDetail(field, FieldErrorCodeInvalid, "the categorization is not enabled")
+		}
+		return "", nil
+	}
+
+	if name == "" {
+		return "", rejectedError(ErrorCodeCategorizationMismatch, "the template does not fit the categorizations of the tournament").
+			WithDetail(field, FieldErrorCodeRequired, "the categorization is enabled but no category is given")
+	}
+
+	category := findByName(name)
+	if category == nil {
+		return "", rejectedError(ErrorCodeCategoryNotFound, "a category of the template does not exist").
+			WithDetail(field, FieldErrorCodeInvalid, fmt.Sprintf("%q does not exist", name))
+	}
+
+	return category.Id, nil
+}
+
+func setupOfCompetition(competition *core.Record) competitionSetup {
+	return competitionSetup{
+		GenderCategory: competition.GetString(names.Fields.Competitions.GenderCategory),
+		TeamSize:       competition.GetInt(names.Fields.Competitions.TeamSize),
+		AgeGroup:       competition.GetString(names.Fields.Competitions.AgeGroup),
+		PlayingLevel:   competition.GetString(names.Fields.Competitions.PlayingLevel),
+	}
+}
+
+// Returns the name of an age group in the form that findAgeGroupByName understands (e.g. "U15")
+func ageGroupName(ageGroup *core.Record) string {
+	prefix := "U"
+	if ageGroup.GetString(names.Fields.AgeGroups.Type) == "over" {
+		prefix = "O"
+	}
+
+	return fmt.Sprintf("%s%d", prefix, ageGroup.GetInt(names.Fields.AgeGroups.Age))
+}
@@ -1,16 +1,13 @@
 package main
 
 import (
-	"errors"
-	"net/http"
-
 	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
 
 	"github.com/pocketbase/pocketbase/core"
 )
 
-// HandleAfterCompetitionUpdated deletes the matches and sets of a competition when the competition has been cancelled
-func HandleAfterCompetitionUpdated(updatedCompetition *core.Record, oldCompetition *core.Record, dao core.App) error {
+// HandleBeforeCompetitionUpdate archives the matches and sets of a competition when the update cancels the competition
+func HandleBeforeCompetitionUpdate(updatedCompetition *core.Record, oldCompetition *core.Record, dao core.App) error {
 	matches := updatedCompetition.GetStringSlice(names.Fields.Competitions.Matches)
 	oldMatchIds := oldCompetition.GetStringSlice(names.Fields.Competitions.Matches)
 
@@ -21,41 +18,37 @@ func HandleAfterCompetitionUpdated(updatedCompetition *core.Record, oldCompetiti
 		return nil
 	}
 
-	if err := dao.ExpandRecord(oldCompetition, []string{names.Fields.Competitions.Matches}, nil); len(err) != 0 {
-		return err[names.Fields.Competitions.Matches]
-	}
-
-	oldMatches := oldCompetition.ExpandedAll(names.Fields.Competitions.Matches)
-
-	if err := dao.ExpandRecords(oldMatches, []string{names.Fields.MatchData.Sets}, nil); len(err) != 0 {
-		return err[names.Fields.MatchData.Sets]
-	}
-
-	oldSetIds := make([]string, 0, 2*len(oldMatches))
-	for _, match := range oldMatches {
-		for _, set := range match.ExpandedAll(names.Fields.MatchData.Sets) {
-			oldSetIds = append(oldSetIds, set.Id)
+	return dao.RunInTransaction(func(txDao core.App) error {
+		// Undoing the cancellation puts the matches back onto their courts and removes the archive
+		archives, err := FetchCollection(names.Collections.CompetitionArchives, txDao)
+		if err != nil {
+			return err
+		}
+		if err := txDao.ExpandRecord(oldCompetition, []string{names.Fields.Competitions.Matches}, nil); len(err) != 0 {
+			return err[names.Fields.Competitions.Matches]
+		}
+		snapshotRecords := append([]*core.Record{oldCompetition}, oldCompetition.ExpandedAll(names.Fields.Competitions.Matches)...)
+
+		if err := CaptureSnapshot(
+			SnapshotOperationCancelCompetition,
+			append(snapshotRecords, archives...),
+			[]string{names.Collections.CompetitionArchives},
+			txDao,
+		); err != nil {
+			return err
 		}
-	}
-
-	if err := DeleteModelsById(names.Collections.MatchData, oldMatchIds, dao); err != nil {
-		return err
-	}
-
-	if err := DeleteModelsById(names.Collections.MatchSets, oldSetIds, dao); err != nil {
-		return err
-	}
 
-	return nil
+		return ArchiveCompetitionRun(oldCompetition, txDao)
+	})
 }
 
 // PostCompetitionMatches handles POST requests to the /api/ezbadminton/competitions route.
 // It creates the given amount of MatchData records and assigns them to the competition.
-// This starts the competition.
+// This starts the competition. The If-Match header can give the expected revision of the competition.
 func PostCompetitionMatches(e *core.RequestEvent, dao core.App) error {
 	info, err := e.RequestInfo()
 	if err != nil {
-		return e.NoContent(http.StatusBadRequest)
+		return RespondError(e, invalidBodyError())
 	}
 
 	body := info.Body
@@ -63,8 +56,11 @@ func PostCompetitionMatches(e *core.RequestEvent, dao core.App) error {
 	competitionIdData, competitionIdExists := body["competition"]
 	numMatchesData, numMatchesExists := body["numMatches"]
 
-	if !competitionIdExists || !numMatchesExists {
-		return e.NoContent(http.StatusBadRequest)
+	if !competitionIdExists {
+		return RespondError(e, missingFieldError("competition"))
+	}
+	if !numMatchesExists {
+		return RespondError(e, missingFieldError("numMatches"))
 	}
 
 	var competitionId string
@@ -74,14 +70,14 @@ func PostCompetitionMatches(e *core.RequestEvent, dao core.App) error {
 	case string:
 		competitionId = val
 	default:
-		return e.NoContent(http.StatusBadRequest)
+		return RespondError(e, invalidFieldError("competition", "the competition has to be given by its ID"))
 	}
 
 	switch val := numMatchesData.(type) {
 	case float64:
 		numMatches = int(val)
 	default:
-		return e.NoContent(http.StatusBadRequest)
+		return RespondError(e, invalidFieldError("numMatches", "the number of matches has to be a number"))
 	}
 
 	transactionError := dao.RunInTransaction(func(txDao core.App) error {
@@ -89,15 +85,18 @@ func PostCompetitionMatches(e *core.RequestEvent, dao core.App) error {
 		if err != nil {
 			return err
 		}
-		competition, err := txDao.FindRecordById(names.Collections.Competitions, competitionId)
+		competition, err := FetchRecord(names.Collections.Competitions, competitionId, txDao)
 		if err != nil {
 			return err
 		}
+		if err := checkRevision(e, competition); err != nil {
+			return err
+		}
 
 		isCompetitionRunning := len(competition.GetStringSlice(names.Fields.Competitions.Matches)) != 0
 
 		if isCompetitionRunning {
-			return errors.New("cannot start an already running competition")
+			return rejectedError(ErrorCodeCompetitionAlreadyRunning, "cannot start an already running competition")
 		}
 
 		newMatchIds := make([]string, 0, numMatches)
@@ -122,7 +121,7 @@ func PostCompetitionMatches(e *core.RequestEvent, dao core.App) error {
 	})
 
 	if transactionError != nil {
-		return e.NoContent(http.StatusInternalServerError)
+		return RespondError(e, transactionError)
 	}
 
 	return nil
@@ -1,6 +1,8 @@
 package main
 
 import (
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/core"
 )
@@ -15,17 +17,28 @@ func FetchCollection(collectionName string, dao core.App) ([]*core.Record, error
 	return records, nil
 }
 
-func FetchAndExpandCollection(collectionName string, dao core.App) ([]*core.Record, error) {
-	competitions, fetchErr := FetchCollection(collectionName, dao)
+// FetchTournament returns the tournament record. There is always exactly one.
+func FetchTournament(dao core.App) (*core.Record, error) {
+	tournament := &core.Record{}
+	if err := dao.RecordQuery(names.Collections.Tournaments).Limit(1).One(tournament); err != nil {
+		return nil, err
+	}
+	return tournament, nil
+}
+
+// FetchAndExpandCollection returns all Records of a collection with the relation paths expanded.
+// Only the declared paths are loaded. See ExpandRelationPaths.
+func FetchAndExpandCollection(collectionName string, relationPaths []string, dao core.App) ([]*core.Record, error) {
+	records, fetchErr := FetchCollection(collectionName, dao)
 	if fetchErr != nil {
 		return nil, fetchErr
 	}
 
-	if err := ExpandAllNestedRelations(competitions, dao); err != nil {
+	if err := ExpandRelationPaths(records, relationPaths, dao); err != nil {
 		return nil, err
 	}
 
-	return competitions, nil
+	return records, nil
 }
 
 // Returns the single record that has a non-empty value in the field with fieldName.
@@ -34,7 +47,7 @@ func GetSingle(records []*core.Record, fieldName string) *core.Record {
 	var singleOne *core.Record = nil
 
 	for _, record := range records {
-		if record.ExpandedOne(fieldName) != nil {
+		if len(record.GetStringSlice(fieldName)) != 0 {
 			if singleOne != nil {
 				return nil
 			} else {
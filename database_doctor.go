@@ -0,0 +1,399 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+// The names of the integrity checks
+const (
+	CheckOrphanedMatchSets   = "orphanedMatchSets"
+	CheckUnregisteredTeams   = "unregisteredTeams"
+	CheckUnregisteredDraw    = "unregisteredDrawEntries"
+	CheckUnregisteredSeeds   = "unregisteredSeedEntries"
+	CheckDoubleRegistrations = "doubleRegistrations"
+	CheckMissingCourts       = "missingCourts"
+	CheckMultipleTournaments = "multipleTournaments"
+)
+
+// A problem that an integrity check found in the tournament database
+type IntegrityProblem struct {
+	Check       string
+	Collection  string
+	Record      string
+	Description string
+
+	// Repairs the problem. The record is fetched again so that the repairs
+	// of other problems of the same record are kept.
+	repair func(dao core.App) error
+}
+
+type IntegrityReport struct {
+	Repaired bool
+	Problems []IntegrityProblem
+}
+
+// NewDoctorCommand creates the "doctor" command that checks the integrity of
+// the tournament database and optionally repairs the problems.
+func NewDoctorCommand(app *pocketbase.PocketBase) *cobra.Command {
+	var repair bool
+
+	command := &cobra.Command{
+		Use:          "doctor",
+		Example:      "doctor --fix",
+		Short:        "Checks the tournament database for inconsistent records and optionally repairs them",
+		SilenceUsage: true,
+		RunE: func(command *cobra.Command, args []string) error {
+			if err := app.RunAllMigrations(); err != nil {
+				return err
+			}
+
+			// The repairs delete records and rely on the relation cleanups that the server registers on serve
+			if err := RegisterRelationHooks(app); err != nil {
+				return err
+			}
+
+			report, err := CheckDatabaseIntegrity(repair, app)
+			if err != nil {
+				return err
+			}
+
+			printIntegrityReport(report)
+
+			return nil
+		},
+	}
+
+	command.Flags().BoolVar(&repair, "fix", false, "repair the problems in one transaction")
+
+	return command
+}
+
+func printIntegrityReport(report *IntegrityReport) {
+	if len(report.Problems) == 0 {
+		fmt.Println("No problems found.")
+		return
+	}
+
+	fmt.Printf("Problems (%d):\n", len(report.Problems))
+	for _, problem := range report.Problems {
+		fmt.Printf("  %s %s/%s: %s\n", problem.Check, problem.Collection, problem.Record, problem.Description)
+	}
+
+	if report.Repaired {
+		fmt.Println("All problems have been repaired.")
+	} else {
+		fmt.Println("Nothing has been repaired. Run with --fix to repair the problems.")
+	}
+}
+
+// CheckDatabaseIntegrity runs all integrity checks and returns the problems that they found.
+// When repair is true the problems are repaired in one transaction.
+func CheckDatabaseIntegrity(repair bool, dao core.App) (*IntegrityReport, error) {
+	report := &IntegrityReport{
+		Problems: []IntegrityProblem{},
+	}
+
+	transactionError := dao.RunInTransaction(func(txDao core.App) error {
+		for _, check := range []func(core.App) ([]IntegrityProblem, error){
+			findOrphanedMatchSets,
+			findUnregisteredTeams,
+			findUnregisteredDrawAndSeeds,
+			findDoubleRegistrations,
+			findMissingCourts,
+			findMultipleTournaments,
+		} {
+			problems, err := check(txDao)
+			if err != nil {
+				return err
+			}
+			report.Problems = append(report.Problems, problems...)
+		}
+
+		if !repair {
+			return nil
+		}
+
+		for _, problem := range report.Problems {
+			if err := problem.repair(txDao); err != nil {
+				return fmt.Errorf("repairing %s of %s/%s failed: %w", problem.Check, problem.Collection, problem.Record, err)
+			}
+		}
+
+		return nil
+	})
+
+	if transactionError != nil {
+		return nil, transactionError
+	}
+
+	report.Repaired = repair
+
+	return report, nil
+}
+
+// Finds the match sets that no match holds
+func findOrphanedMatchSets(dao core.App) ([]IntegrityProblem, error) {
+	heldSets, err := collectRelationIds(names.Collections.MatchData, []string{names.Fields.MatchData.Sets}, dao)
+	if err != nil {
+		return nil, err
+	}
+
+	sets, err := FetchCollection(names.Collections.MatchSets, dao)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := []IntegrityProblem{}
+	for _, set := range sets {
+		if _, isHeld := heldSets[set.Id]; isHeld {
+			continue
+		}
+
+		problems = append(problems, IntegrityProblem{
+			Check:       CheckOrphanedMatchSets,
+			Collection:  names.Collections.MatchSets,
+			Record:      set.Id,
+			Description: "the set does not belong to any match and will be deleted",
+			repair:      deleteRecordRepair(names.Collections.MatchSets, set.Id),
+		})
+	}
+
+	return problems, nil
+}
+
+// Finds the teams that no competition holds in its registrations or waitlist
+func findUnregisteredTeams(dao core.App) ([]IntegrityProblem, error) {
+	registeredTeams, err := collectRelationIds(
+		names.Collections.Competitions,
+		[]string{names.Fields.Competitions.Registrations, names.Fields.Competitions.Waitlist},
+		dao,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	teams, err := FetchCollection(names.Collections.Teams, dao)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := []IntegrityProblem{}
+	for _, team := range teams {
+		if _, isRegistered := registeredTeams[team.Id]; isRegistered {
+			continue
+		}
+
+		problems = append(problems, IntegrityProblem{
+			Check:       CheckUnregisteredTeams,
+			Collection:  names.Collections.Teams,
+			Record:      team.Id,
+			Description: "the team is not registered for any competition and will be deleted",
+			repair:      deleteRecordRepair(names.Collections.Teams, team.Id),
+		})
+	}
+
+	return problems, nil
+}
+
+// Finds the competitions whose draw or seeds contain teams that are not in their registrations
+func findUnregisteredDrawAndSeeds(dao core.App) ([]IntegrityProblem, error) {
+	competitions, err := FetchCollection(names.Collections.Competitions, dao)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := []IntegrityProblem{}
+	for _, competition := range competitions {
+		registrations := competition.GetStringSlice(names.Fields.Competitions.Registrations)
+
+		for _, teamList := range []struct {
+			check     string
+			fieldName string
+		}{
+			{CheckUnregisteredDraw, names.Fields.Competitions.Draw},
+			{CheckUnregisteredSeeds, names.Fields.Competitions.Seeds},
+		} {
+			check, fieldName := teamList.check, teamList.fieldName
+			unregisteredTeams := withoutIds(competition.GetStringSlice(fieldName), registrations)
+			if len(unregisteredTeams) == 0 {
+				continue
+			}
+
+			problems = append(problems, IntegrityProblem{
+				Check:       check,
+				Collection:  names.Collections.Competitions,
+				Record:      competition.Id,
+				Description: fmt.Sprintf("the unregistered teams %v will be removed from the %s", unregisteredTeams, fieldName),
+				repair: func(dao core.App) error {
+					competition, err := dao.FindRecordById(names.Collections.Competitions, competition.Id)
+					if err != nil {
+						return err
+					}
+
+					competition.Set(fieldName, withoutIds(competition.GetStringSlice(fieldName), unregisteredTeams))
+
+					// The competition may have other invalid relations that the doctor does not repair
+					return dao.SaveNoValidate(competition)
+				},
+			})
+		}
+	}
+
+	return problems, nil
+}
+
+// Finds the players who are in more than one registered or waitlisted team of a competition.
+// The first registered team of the player is kept. A waitlisted team is only kept when the
+// player is not registered with another team.
+func findDoubleRegistrations(dao core.App) ([]IntegrityProblem, error) {
+	competitions, err := FetchCollection(names.Collections.Competitions, dao)
+	if err != nil {
+		return nil, err
+	}
+
+	teamFields := []string{names.Fields.Competitions.Registrations, names.Fields.Competitions.Waitlist}
+	if errs := dao.ExpandRecords(competitions, teamFields, nil); len(errs) != 0 {
+		return nil, errors.New("could not expand the teams of the competitions")
+	}
+
+	problems := []IntegrityProblem{}
+	for _, competition := range competitions {
+		// The first registered team of each player
+		teamsOfPlayers := map[string]string{}
+
+		teams := slices.Concat(
+			competition.ExpandedAll(names.Fields.Competitions.Registrations),
+			competition.ExpandedAll(names.Fields.Competitions.Waitlist),
+		)
+
+		for _, team := range teams {
+			for _, playerId := range team.GetStringSlice(names.Fields.Teams.Players) {
+				firstTeamId, isRegistered := teamsOfPlayers[playerId]
+				if !isRegistered {
+					teamsOfPlayers[playerId] = team.Id
+					continue
+				}
+
+				problems = append(problems, IntegrityProblem{
+					Check:      CheckDoubleRegistrations,
+					Collection: names.Collections.Teams,
+					Record:     team.Id,
+					Description: fmt.Sprintf(
+						"the player %s is also entered for competition %s with team %s. The team will be deleted",
+						playerId, competition.Id, firstTeamId,
+					),
+					repair: deleteRecordRepair(names.Collections.Teams, team.Id),
+				})
+				break
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// Finds the matches whose court does not exist
+func findMissingCourts(dao core.App) ([]IntegrityProblem, error) {
+	courts, err := FetchCollection(names.Collections.Courts, dao)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := FetchCollection(names.Collections.MatchData, dao)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := []IntegrityProblem{}
+	for _, match := range matches {
+		courtId := match.GetString(names.Fields.MatchData.Court)
+		if courtId == "" || slices.ContainsFunc(courts, func(court *core.Record) bool { return court.Id == courtId }) {
+			continue
+		}
+
+		problems = append(problems, IntegrityProblem{
+			Check:       CheckMissingCourts,
+			Collection:  names.Collections.MatchData,
+			Record:      match.Id,
+			Description: fmt.Sprintf("the court %s does not exist and will be removed from the match", courtId),
+			repair: func(dao core.App) error {
+				match, err := dao.FindRecordById(names.Collections.MatchData, match.Id)
+				if err != nil {
+					return err
+				}
+
+				match.Set(names.Fields.MatchData.Court, "")
+
+				// The match may have other invalid relations that the doctor does not repair
+				return dao.SaveNoValidate(match)
+			},
+		})
+	}
+
+	return problems, nil
+}
+
+// Finds the tournament records besides the one that FetchTournament returns
+func findMultipleTournaments(dao core.App) ([]IntegrityProblem, error) {
+	tournaments := []*core.Record{}
+	if err := dao.RecordQuery(names.Collections.Tournaments).OrderBy("rowid").All(&tournaments); err != nil {
+		return nil, err
+	}
+
+	problems := []IntegrityProblem{}
+	for _, tournament := range tournaments[min(1, len(tournaments)):] {
+		problems = append(problems, IntegrityProblem{
+			Check:       CheckMultipleTournaments,
+			Collection:  names.Collections.Tournaments,
+			Record:      tournament.Id,
+			Description: fmt.Sprintf("there can only be one tournament. The tournament %s is kept and this one will be deleted", tournaments[0].Id),
+			repair:      deleteRecordRepair(names.Collections.Tournaments, tournament.Id),
+		})
+	}
+
+	return problems, nil
+}
+
+// Returns the set of IDs that the records of the collection hold in the relation fields
+func collectRelationIds(collectionName string, fieldNames []string, dao core.App) (map[string]struct{}, error) {
+	records, err := FetchCollection(collectionName, dao)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := map[string]struct{}{}
+	for _, record := range records {
+		for _, fieldName := range fieldNames {
+			for _, id := range record.GetStringSlice(fieldName) {
+				ids[id] = struct{}{}
+			}
+		}
+	}
+
+	return ids, nil
+}
+
+// Returns a repair that deletes the record unless it has already been deleted
+// by the repair of another problem
+func deleteRecordRepair(collectionName string, id string) func(dao core.App) error {
+	return func(dao core.App) error {
+		record, err := dao.FindRecordById(collectionName, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		return dao.Delete(record)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"slices"
+
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+)
+
+// The base of the domain events
+type DomainEvent struct {
+	hook.Event
+
+	// The app of the transaction that the change is saved in
+	App core.App
+}
+
+// A match got its end time
+type MatchFinishedEvent struct {
+	DomainEvent
+	Match *Match
+}
+
+// A team has been withdrawn from the registrations of a competition by an update of the
+// competition or the deletion of the team. The event is published before the change is saved.
+// Teams that merges and splits of competitions move between competitions do not withdraw.
+type TeamWithdrewEvent struct {
+	DomainEvent
+	Competition *Competition
+	TeamId      string
+}
+
+// The matches of a competition have been created
+type CompetitionStartedEvent struct {
+	DomainEvent
+	Competition *Competition
+}
+
+// An age group or playing level has been deleted. The competitions of the category
+// have been moved to the replacement category or deleted as described by the report.
+// The report is nil when the category was not deleted by DeleteCategory. Its competitions
+// then only lost the category.
+type CategoryDeletedEvent struct {
+	DomainEvent
+	Category      *core.Record
+	ReplacementId string
+	Report        *CategoryChangeReport
+}
+
+// A court does not host an unfinished match anymore because the match finished,
+// moved to another court or has been deleted. The court itself may be in the process
+// of being deleted when its matches are nullified (see DeleteNullify).
+type CourtFreedEvent struct {
+	DomainEvent
+	CourtId string
+	Match   *Match
+}
+
+// DomainEvents are the hooks that the domain events are published on.
+//
+// The handlers run in the transaction of the change that caused the event in the order
+// of their priority (see hook.Handler). Each handler has to call e.Next() to continue the
+// chain. An error of a handler stops the chain and rolls back the change.
+var DomainEvents = struct {
+	MatchFinished      *hook.Hook[*MatchFinishedEvent]
+	TeamWithdrew       *hook.Hook[*TeamWithdrewEvent]
+	CompetitionStarted *hook.Hook[*CompetitionStartedEvent]
+	CategoryDeleted    *hook.Hook[*CategoryDeletedEvent]
+	CourtFreed         *hook.Hook[*CourtFreedEvent]
+}{
+	MatchFinished:      &hook.Hook[*MatchFinishedEvent]{},
+	TeamWithdrew:       &hook.Hook[*TeamWithdrewEvent]{},
+	CompetitionStarted: &hook.Hook[*CompetitionStartedEvent]{},
+	CategoryDeleted:    &hook.Hook[*CategoryDeletedEvent]{},
+	CourtFreed:         &hook.Hook[*CourtFreedEvent]{},
+}
+
+// RegisterDomainEventPublishers registers the record hooks that publish the domain events
+// of match, competition and category changes. Snapshot restores do not publish any events.
+// The withdrawals of teams are published by the requests that withdraw them.
+//
+// The previous state of an updated record is read from the database before the update
+// because the original of a record is not refreshed when it is saved more than once.
+func RegisterDomainEventPublishers(app *pocketbase.PocketBase) {
+	app.OnRecordUpdate(names.Collections.MatchData).BindFunc(func(e *core.RecordEvent) error {
+		if isSnapshotRestore(e) {
+			return e.Next()
+		}
+
+		var previousMatch *Match
+
+		return runRecordEventInTransaction(
+			e,
+			func(txApp core.App) error {
+				var err error
+				previousMatch, err = FindMatch(e.Record.Id, txApp)
+				return err
+			},
+			func(txApp core.App) error {
+				return publishMatchUpdateEvents(previousMatch, WrapRecord[Match](e.Record), txApp)
+			},
+		)
+	})
+
+	app.OnRecordDelete(names.Collections.MatchData).BindFunc(func(e *core.RecordEvent) error {
+		if isSnapshotRestore(e) {
+			return e.Next()
+		}
+
+		return runRecordEventInTransaction(e, nil, func(txApp core.App) error {
+			match := WrapRecord[Match](e.Record)
+			if match.CourtId() == "" || !match.EndTime().IsZero() {
+				return nil
+			}
+
+			return publishCourtFreed(match.CourtId(), match, txApp)
+		})
+	})
+
+	app.OnRecordUpdate(names.Collections.Competitions).BindFunc(func(e *core.RecordEvent) error {
+		if isSnapshotRestore(e) {
+			return e.Next()
+		}
+
+		var previousCompetition *Competition
+
+		return runRecordEventInTransaction(
+			e,
+			func(txApp core.App) error {
+				var err error
+				previousCompetition, err = FindCompetition(e.Record.Id, txApp)
+				return err
+			},
+			func(txApp core.App) error {
+				return publishCompetitionUpdateEvents(previousCompetition, WrapRecord[Competition](e.Record), txApp)
+			},
+		)
+	})
+
+	app.OnRecordUpdateRequest(names.Collections.Competitions).BindFunc(func(e *core.RecordRequestEvent) error {
+		return runRequestInTransaction(e, func(txApp core.App) error {
+			competition := WrapRecord[Competition](e.Record)
+			previousRegistrations := e.Record.Original().GetStringSlice(names.Fields.Competitions.Registrations)
+
+			for _, teamId := range withoutIds(previousRegistrations, competition.RegistrationIds()) {
+				if err := publishTeamWithdrew(competition, teamId, txApp); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	})
+
+	app.OnRecordDeleteRequest(names.Collections.Teams).BindFunc(func(e *core.RecordRequestEvent) error {
+		return runRequestInTransaction(e, func(txApp core.App) error {
+			competitions, err := findCompetitionsOfTeam(e.Record.Id, txApp)
+			if err != nil {
+				return err
+			}
+
+			for _, competition := range WrapRecords[Competition](competitions) {
+				if !slices.Contains(competition.RegistrationIds(), e.Record.Id) {
+					continue
+				}
+				if err := publishTeamWithdrew(competition, e.Record.Id, txApp); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	})
+
+	app.OnRecordDelete(names.Collections.AgeGroups, names.Collections.PlayingLevels).BindFunc(func(e *core.RecordEvent) error {
+		if isSnapshotRestore(e) {
+			return e.Next()
+		}
+
+		return runRecordEventInTransaction(e, nil, func(txApp core.App) error {
+			deletion := &categoryDeletion{}
+			if e.Context != nil {
+				if contextDeletion, ok := e.Context.Value(categoryDeletionKey{}).(*categoryDeletion); ok {
+					deletion = contextDeletion
+				}
+			}
+
+			return publishCategoryDeleted(e.Record, deletion.replacementCategoryId, deletion.report, txApp)
+		})
+	})
+}
+
+func publishMatchUpdateEvents(previousMatch *Match, match *Match, dao core.App) error {
+	freedCourtIds := []string{}
+
+	if previousMatch.EndTime().IsZero() && !match.EndTime().IsZero() {
+		err := DomainEvents.MatchFinished.Trigger(&MatchFinishedEvent{
+			DomainEvent: DomainEvent{App: dao},
+			Match:       match,
+		})
+		if err != nil {
+			return err
+		}
+
+		freedCourtIds = append(freedCourtIds, previousMatch.CourtId())
+		if match.CourtId() != previousMatch.CourtId() {
+			freedCourtIds = append(freedCourtIds, match.CourtId())
+		}
+	} else if previousMatch.EndTime().IsZero() && previousMatch.CourtId() != match.CourtId() {
+		freedCourtIds = append(freedCourtIds, previousMatch.CourtId())
+	}
+
+	for _, courtId := range freedCourtIds {
+		if courtId == "" {
+			continue
+		}
+
+		if err := publishCourtFreed(courtId, match, dao); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func publishCompetitionUpdateEvents(previousCompetition *Competition, competition *Competition, dao core.App) error {
+	if !previousCompetition.IsRunning() && competition.IsRunning() {
+		return DomainEvents.CompetitionStarted.Trigger(&CompetitionStartedEvent{
+			DomainEvent: DomainEvent{App: dao},
+			Competition: competition,
+		})
+	}
+
+	return nil
+}
+
+func publishTeamWithdrew(competition *Competition, teamId string, dao core.App) error {
+	return DomainEvents.TeamWithdrew.Trigger(&TeamWithdrewEvent{
+		DomainEvent: DomainEvent{App: dao},
+		Competition: competition,
+		TeamId:      teamId,
+	})
+}
+
+func publishCourtFreed(courtId string, match *Match, dao core.App) error {
+	return DomainEvents.CourtFreed.Trigger(&CourtFreedEvent{
+		DomainEvent: DomainEvent{App: dao},
+		CourtId:     courtId,
+		Match:       match,
+	})
+}
+
+func publishCategoryDeleted(
+	category *core.Record,
+	replacementCategoryId string,
+	report *CategoryChangeReport,
+	dao core.App,
+) error {
+	return DomainEvents.CategoryDeleted.Trigger(&CategoryDeletedEvent{
+		DomainEvent:   DomainEvent{App: dao},
+		Category:      category,
+		ReplacementId: replacementCategoryId,
+		Report:        report,
+	})
+}
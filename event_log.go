@@ -0,0 +1,331 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// The types of the event log entries
+const (
+	// The state of a record when the event log was introduced
+	EventTypeInitialState = names.EventTypeInitialState
+
+	EventTypeCreated = "created"
+	EventTypeUpdated = "updated"
+	EventTypeDeleted = "deleted"
+
+	EventTypeResultEntered = "resultEntered"
+	EventTypeCourtAssigned = "courtAssigned"
+	EventTypeTeamCreated   = "teamCreated"
+	EventTypeTeamsMerged   = "teamsMerged"
+	EventTypeDrawGenerated = "drawGenerated"
+
+	// A record has been put back by a snapshot restore
+	EventTypeRestored = "restored"
+)
+
+// The collections whose changes are kept in the event log
+var eventLogCollections = []string{
+	names.Collections.AgeGroups,
+	names.Collections.PlayingLevels,
+	names.Collections.Clubs,
+	names.Collections.Players,
+	names.Collections.Tournaments,
+	names.Collections.TournamentModeSettings,
+	names.Collections.TieBreakers,
+	names.Collections.Gymnasiums,
+	names.Collections.Courts,
+	names.Collections.MatchSets,
+	names.Collections.MatchData,
+	names.Collections.Teams,
+	names.Collections.Competitions,
+	names.Collections.CompetitionArchives,
+	names.Collections.MergeLogs,
+}
+
+// The tournament state that the event log has been replayed to
+type TournamentState struct {
+	At types.DateTime
+
+	// The records that existed at the time mapped by their collection
+	Records map[string][]map[string]any
+}
+
+// RegisterEventLog registers the hooks that append every change of the logged collections
+// to the event log. The entry stores the state of the record after the change and the time.
+// The authenticated user who requested the change is added as its actor by the requests
+// (see RegisterEventLogActors and withEventLogActor).
+//
+// The entries are written in the transaction of the change. The log itself can not be changed.
+func RegisterEventLog(app *pocketbase.PocketBase) {
+	app.OnRecordCreate(eventLogCollections...).BindFunc(func(e *core.RecordEvent) error {
+		return runRecordEventInTransaction(e, nil, func(txApp core.App) error {
+			eventType := createEventType(e.Record)
+			if isSnapshotRestore(e) {
+				eventType = EventTypeRestored
+			}
+
+			return appendEventLog(eventType, e.Record, txApp)
+		})
+	})
+
+	app.OnRecordUpdate(eventLogCollections...).BindFunc(func(e *core.RecordEvent) error {
+		var previousRecord *core.Record
+
+		return runRecordEventInTransaction(
+			e,
+			func(txApp core.App) error {
+				// The original of the record is not refreshed when it is saved more than once
+				var err error
+				previousRecord, err = txApp.FindRecordById(e.Record.Collection(), e.Record.Id)
+				return err
+			},
+			func(txApp core.App) error {
+				eventType := updateEventType(previousRecord, e.Record)
+				if isSnapshotRestore(e) {
+					eventType = EventTypeRestored
+				}
+
+				return appendEventLog(eventType, e.Record, txApp)
+			},
+		)
+	})
+
+	app.OnRecordDelete(eventLogCollections...).BindFunc(func(e *core.RecordEvent) error {
+		return runRecordEventInTransaction(e, nil, func(txApp core.App) error {
+			return appendEventLog(EventTypeDeleted, e.Record, txApp)
+		})
+	})
+
+	rejectEventLogChange := func(e *core.RecordEvent) error {
+		return rejectedError(ErrorCodeEventLogAppendOnly, "the entries of the event log can not be changed")
+	}
+	app.OnRecordUpdate(names.Collections.EventLog).BindFunc(rejectEventLogChange)
+	app.OnRecordDelete(names.Collections.EventLog).BindFunc(rejectEventLogChange)
+}
+
+// GetEventLogState handles GET requests to the /api/ezbadminton/event_log/state route.
+// It responds with the tournament state as it was at the time given by the "at" query parameter.
+//
+// The entries that led to the state of a record are listed by the event log collection
+// (e.g. filter=(collection='match_data' && record='...')).
+func GetEventLogState(e *core.RequestEvent, dao core.App) error {
+	atParam := e.Request.URL.Query().Get("at")
+	if atParam == "" {
+		return RespondError(e, missingFieldError("at"))
+	}
+
+	at, err := types.ParseDateTime(atParam)
+	if err != nil || at.IsZero() {
+		return RespondError(e, invalidFieldError("at", "the time is not a valid date"))
+	}
+
+	state, err := ReplayEventLog(at, dao)
+	if err != nil {
+		return RespondError(e, err)
+	}
+
+	return e.JSON(http.StatusOK, state)
+}
+
+// ReplayEventLog rebuilds the state of the logged collections at the given time from the event log.
+// Records that existed before the event log was introduced are known from their initial state.
+func ReplayEventLog(at types.DateTime, dao core.App) (*TournamentState, error) {
+	events := []*core.Record{}
+	err := dao.RecordQuery(names.Collections.EventLog).
+		AndWhere(dbx.NewExp("[["+names.Fields.EventLog.Created+"]] <= {:at}", dbx.Params{"at": at.String()})).
+		OrderBy(names.Fields.EventLog.Created+" ASC", "rowid ASC").
+		All(&events)
+	if err != nil {
+		return nil, err
+	}
+
+	// The data of the records mapped by collection and ID
+	recordData := map[string]map[string]map[string]any{}
+
+	for _, event := range events {
+		collectionName := event.GetString(names.Fields.EventLog.Collection)
+		recordId := event.GetString(names.Fields.EventLog.Record)
+
+		if _, exists := recordData[collectionName]; !exists {
+			recordData[collectionName] = map[string]map[string]any{}
+		}
+
+		if event.GetString(names.Fields.EventLog.Type) == EventTypeDeleted {
+			delete(recordData[collectionName], recordId)
+			continue
+		}
+
+		data := map[string]any{}
+		if err := event.UnmarshalJSONField(names.Fields.EventLog.Data, &data); err != nil {
+			return nil, err
+		}
+		recordData[collectionName][recordId] = data
+	}
+
+	state := &TournamentState{
+		At:      at,
+		Records: map[string][]map[string]any{},
+	}
+
+	for collectionName, records := range recordData {
+		ids := make([]string, 0, len(records))
+		for id := range records {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+
+		state.Records[collectionName] = make([]map[string]any, 0, len(ids))
+		for _, id := range ids {
+			state.Records[collectionName] = append(state.Records[collectionName], records[id])
+		}
+	}
+
+	return state, nil
+}
+
+// Appends the change of the record to the event log
+func appendEventLog(eventType string, record *core.Record, dao core.App) error {
+	eventLogCollection, err := dao.FindCachedCollectionByNameOrId(names.Collections.EventLog)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The records of the migrations before the event log are logged as its initial state
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	event := core.NewRecord(eventLogCollection)
+	event.Set(names.Fields.EventLog.Type, eventType)
+	event.Set(names.Fields.EventLog.Collection, record.Collection().Name)
+	event.Set(names.Fields.EventLog.Record, record.Id)
+	if eventType != EventTypeDeleted {
+		event.Set(names.Fields.EventLog.Data, record.FieldsData())
+	}
+
+	return dao.Save(event)
+}
+
+// RegisterEventLogActors registers the record request hooks that add the authenticated user
+// of the request as the actor of the event log entries that the request appended.
+// The hooks have to be registered before all other record request hooks so that
+// the changes of those hooks are in the transaction of the request.
+func RegisterEventLogActors(app *pocketbase.PocketBase) {
+	logActor := func(e *core.RecordRequestEvent) error {
+		if e.Auth == nil {
+			return e.Next()
+		}
+
+		originalApp := e.App
+		defer func() { e.App = originalApp }()
+
+		return e.App.RunInTransaction(func(txApp core.App) error {
+			e.App = txApp
+			return runWithEventLogActor(e.Auth.Id, txApp, e.Next)
+		})
+	}
+
+	app.OnRecordCreateRequest().BindFunc(logActor)
+	app.OnRecordUpdateRequest().BindFunc(logActor)
+	app.OnRecordDeleteRequest().BindFunc(logActor)
+}
+
+// An app whose transactions add the actor to the event log entries that they append
+type eventLogActorApp struct {
+	core.App
+	actorId string
+}
+
+// Returns the app that the handler of a custom write route changes the records with.
+// The changes are logged with the authenticated user of the request as their actor
+// when the handler makes them in a transaction of the app.
+func withEventLogActor(e *core.RequestEvent, app core.App) core.App {
+	if e.Auth == nil {
+		return app
+	}
+
+	return &eventLogActorApp{App: app, actorId: e.Auth.Id}
+}
+
+func (app *eventLogActorApp) RunInTransaction(fn func(txApp core.App) error) error {
+	return app.App.RunInTransaction(func(txApp core.App) error {
+		return runWithEventLogActor(app.actorId, txApp, func() error { return fn(txApp) })
+	})
+}
+
+// Runs fn in the transaction and sets the actor of the event log entries that fn appended.
+// The database has only one connection that writes, so the entries after the last entry
+// from before fn are the entries of the transaction.
+func runWithEventLogActor(actorId string, txApp core.App, fn func() error) error {
+	var lastRowId int64
+	err := txApp.NonconcurrentDB().
+		NewQuery("SELECT COALESCE(MAX(rowid), 0) FROM {{" + names.Collections.EventLog + "}}").
+		Row(&lastRowId)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	// The update bypasses the hooks that keep the entries from being changed
+	_, err = txApp.NonconcurrentDB().Update(
+		names.Collections.EventLog,
+		dbx.Params{names.Fields.EventLog.Actor: actorId},
+		dbx.And(
+			dbx.NewExp("rowid > {:lastRowId}", dbx.Params{"lastRowId": lastRowId}),
+			dbx.HashExp{names.Fields.EventLog.Actor: ""},
+		),
+	).Execute()
+
+	return err
+}
+
+// Returns the event type of the created record
+func createEventType(record *core.Record) string {
+	switch record.Collection().Name {
+	case names.Collections.Teams:
+		return EventTypeTeamCreated
+	case names.Collections.MergeLogs:
+		return EventTypeTeamsMerged
+	}
+
+	return EventTypeCreated
+}
+
+// Returns the event type of the update of the record
+func updateEventType(previousRecord *core.Record, record *core.Record) string {
+	switch record.Collection().Name {
+	case names.Collections.MatchData:
+		previousMatch, match := WrapRecord[Match](previousRecord), WrapRecord[Match](record)
+
+		if len(match.SetIds()) != 0 && !slices.Equal(previousMatch.SetIds(), match.SetIds()) {
+			return EventTypeResultEntered
+		}
+		if match.CourtId() != "" && previousMatch.CourtId() != match.CourtId() {
+			return EventTypeCourtAssigned
+		}
+	case names.Collections.Competitions:
+		previousCompetition, competition := WrapRecord[Competition](previousRecord), WrapRecord[Competition](record)
+
+		previousDraw, draw := previousCompetition.DrawIds(), competition.DrawIds()
+
+		// Removing teams from the draw does not draw it again
+		removedTeams := withoutIds(previousDraw, draw)
+		if len(draw) != 0 && !slices.Equal(withoutIds(previousDraw, removedTeams), draw) {
+			return EventTypeDrawGenerated
+		}
+	}
+
+	return EventTypeUpdated
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
 
 	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
 
@@ -13,96 +15,107 @@ import (
 
 func RegisterHooks(app *pocketbase.PocketBase) {
 
+	// The actor hooks enclose the other record request hooks in their transaction
+	RegisterEventLogActors(app)
+
+	// The revisions are checked before any other request hook changes something
+	RegisterRevisionChecks(app)
+
 	app.OnRecordUpdateRequest(names.Collections.Tournaments).BindFunc(func(e *core.RecordRequestEvent) error {
-		if err := OnTournamentSettingsUpdate(e.Record.Original(), e.Record, app); err != nil {
-			return err
-		}
-		return e.Next()
+		// The merges of a disabled categorization are rolled back when the settings can't be saved
+		return runRequestInTransaction(e, func(txApp core.App) error {
+			result, err := OnTournamentSettingsUpdate(e.Record.Original(), e.Record, txApp)
+			if err != nil {
+				return err
+			}
+
+			// The updated tournament in the response carries the result of the merges
+			e.Record.WithCustomData(true)
+			e.Record.Set(CategorizationChangeResultKey, result)
+
+			return nil
+		})
 	})
 
+	// The category delete requests end in this hook. It does not call e.Next() because the
+	// default action would respond with an empty 204 instead of the report of the changes.
+	// The hook deletes the category itself (see DeleteCategory), so the record hooks of the
+	// deletion still run. Delete request hooks of the categories that are bound after this
+	// one are never called.
 	app.OnRecordDeleteRequest(names.Collections.PlayingLevels, names.Collections.AgeGroups).BindFunc(func(e *core.RecordRequestEvent) error {
 		replacementCategoryId := e.Request.URL.Query().Get("replacement")
 
-		if err := HandleDeletedCategory(e.Record, replacementCategoryId, app); err != nil {
-			return err
+		report, err := DeleteCategory(e.Record, replacementCategoryId, e.App)
+		if err != nil {
+			return RespondError(e.RequestEvent, err)
 		}
-		return e.Next()
-	})
 
-	app.OnRecordDeleteRequest(names.Collections.Competitions).BindFunc(func(e *core.RecordRequestEvent) error {
-		if err := HandleDeletedCompetition(e.Record, app); err != nil {
-			return err
-		}
-		return e.Next()
+		// Ends the chain (see above)
+		return e.JSON(http.StatusOK, report)
 	})
 
 	app.OnRecordUpdateRequest(names.Collections.Teams).BindFunc(func(e *core.RecordRequestEvent) error {
-		if err := HandleUpdatedTeam(e.Record, app); err != nil {
-			return err
+		if err := HandleUpdatedTeam(e.Record, e.App); err != nil {
+			return RespondError(e.RequestEvent, err)
 		}
 		return e.Next()
 	})
 
 	app.OnRecordCreateRequest(names.Collections.Teams).BindFunc(func(e *core.RecordRequestEvent) error {
-		if err := e.Next(); err != nil {
-			return err
-		}
-
 		competitionId := e.Request.URL.Query().Get("competition")
 
-		return HandleCreatedTeam(e.Record, competitionId, app)
-	})
-
-	app.OnRecordUpdateRequest(names.Collections.Competitions).BindFunc(func(e *core.RecordRequestEvent) error {
-		if err := e.Next(); err != nil {
-			return nil
+		if err := HandleBeforeTeamCreate(e.Record, competitionId, e.App); err != nil {
+			return RespondError(e.RequestEvent, err)
 		}
-		return HandleAfterCompetitionUpdated(e.Record, e.Record.Original(), app)
-	})
 
-	app.OnRecordUpdateRequest(names.Collections.MatchData).BindFunc(func(e *core.RecordRequestEvent) error {
 		if err := e.Next(); err != nil {
 			return err
 		}
-		return HandleAfterUpdatedMatch(e.Record, e.Record.Original(), app)
+
+		return HandleCreatedTeam(e.Record, competitionId, e.App)
 	})
 
-	app.OnRecordDeleteRequest(names.Collections.Gymnasiums).BindFunc(func(e *core.RecordRequestEvent) error {
-		if err := HandleBeforeGymnasiumDelete(e.Record, app); err != nil {
-			return err
-		}
-		return e.Next()
+	app.OnRecordUpdateRequest(names.Collections.Competitions).BindFunc(func(e *core.RecordRequestEvent) error {
+		// The matches of a cancelled competition are archived before the update is saved
+		// so that a failed archive does not leave the competition cancelled
+		return runRequestInTransaction(e, func(txApp core.App) error {
+			return HandleBeforeCompetitionUpdate(e.Record, e.Record.Original(), txApp)
+		})
 	})
 
 	app.OnRecordCreateRequest(names.Collections.TournamentOrganizer).BindFunc(func(e *core.RecordRequestEvent) error {
-		if err := HandleBeforeTournamentOrganizerCreate(app); err != nil {
-			return err
+		if err := HandleBeforeTournamentOrganizerCreate(e.App); err != nil {
+			return RespondError(e.RequestEvent, err)
 		}
 		return e.Next()
 	})
 
-	app.OnRecordUpdate(names.Collections.Teams).BindFunc(func(e *core.RecordEvent) error {
+	app.OnRecordUpdate(names.Collections.Competitions).BindFunc(func(e *core.RecordEvent) error {
 		if err := e.Next(); err != nil {
 			return err
 		}
-		return HandleAfterUpdatedTeam(e.Record, app)
+		if isSnapshotRestore(e) {
+			return nil
+		}
+		return HandleAfterUpdatedCompetition(e.Record, e.App)
 	})
 
-	// Register all relation update cascades
-	app.OnServe().BindFunc(func(e *core.ServeEvent) error {
-		RegisterRelationUpdateCascade(names.Collections.Competitions, names.Fields.Competitions.PlayingLevel, app)
-		RegisterRelationUpdateCascade(names.Collections.Competitions, names.Fields.Competitions.Matches, app)
-		RegisterRelationUpdateCascade(names.Collections.Competitions, names.Fields.Competitions.TieBreakers, app)
-		// This relation cascade is handled by the HandleAfterUpdatedTeam hook
-		//RegisterRelationUpdateCascade(competitionsName, registrationsName, app)
+	RegisterDomainEventPublishers(app)
 
-		RegisterRelationUpdateCascade(names.Collections.Teams, names.Fields.Teams.Players, app)
+	RegisterEventLog(app)
 
-		RegisterRelationUpdateCascade(names.Collections.MatchData, names.Fields.MatchData.Court, app)
-		RegisterRelationUpdateCascade(names.Collections.MatchData, names.Fields.MatchData.Sets, app)
+	// Register the relation indexes of the reverse lookups
+	RegisterRelationIndex(names.Collections.Competitions, names.Fields.Competitions.Registrations, app)
+	RegisterRelationIndex(names.Collections.Competitions, names.Fields.Competitions.Matches, app)
+	RegisterRelationIndex(names.Collections.Teams, names.Fields.Teams.Players, app)
 
-		RegisterRelationUpdateCascade(names.Collections.Courts, names.Fields.Courts.Gymnasium, app)
+	// Register all relation update cascades
+	RegisterCascadeBatchFlush(app)
 
+	app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+		if err := RegisterRelationHooks(app); err != nil {
+			return err
+		}
 		return e.Next()
 	})
 
@@ -114,18 +127,151 @@ func RegisterHooks(app *pocketbase.PocketBase) {
 
 }
 
+// Whether the relation hooks have been registered
+var relationHooksRegistered = false
+
+// RegisterRelationHooks registers the relation update cascades and the cleanups of related records.
+// The hooks look up the relation fields of the collections so the database has to be migrated
+// before they are registered. The server registers them on serve and the CLI commands after they
+// ran the migrations. Repeated calls do nothing.
+func RegisterRelationHooks(app *pocketbase.PocketBase) error {
+	if relationHooksRegistered {
+		return nil
+	}
+	relationHooksRegistered = true
+
+	return errors.Join(
+		RegisterRelationUpdateCascade(names.Collections.Competitions, names.Fields.Competitions.PlayingLevel, app),
+		RegisterRelationUpdateCascade(names.Collections.Competitions, names.Fields.Competitions.Matches, app),
+		RegisterRelationUpdateCascade(names.Collections.Competitions, names.Fields.Competitions.TieBreakers, app),
+		RegisterRelationUpdateCascade(names.Collections.Competitions, names.Fields.Competitions.Registrations, app),
+
+		RegisterRelationUpdateCascade(names.Collections.Teams, names.Fields.Teams.Players, app),
+
+		RegisterRelationUpdateCascade(names.Collections.MatchData, names.Fields.MatchData.Court, app),
+		RegisterRelationUpdateCascade(names.Collections.MatchData, names.Fields.MatchData.Sets, app),
+
+		RegisterRelationUpdateCascade(names.Collections.Courts, names.Fields.Courts.Gymnasium, app),
+
+		// Register the cleanups of related records
+		RegisterRelationDeleteRule(names.Collections.Courts, names.Fields.Courts.Gymnasium, DeleteCascade, app),
+		RegisterRelationDeleteRule(names.Collections.MatchData, names.Fields.MatchData.Court, DeleteNullify, app),
+
+		RegisterOwnedRelation(names.Collections.Competitions, names.Fields.Competitions.Registrations, false, app),
+		RegisterOwnedRelation(names.Collections.Competitions, names.Fields.Competitions.Waitlist, false, app),
+		RegisterOwnedRelation(names.Collections.MatchData, names.Fields.MatchData.Sets, true, app),
+		// The matches of a cancelled competition are held by its archive
+		RegisterOwnedRelation(names.Collections.Competitions, names.Fields.Competitions.Matches, false, app),
+		RegisterOwnedRelation(names.Collections.CompetitionArchives, names.Fields.CompetitionArchives.Matches, false, app),
+
+		RegisterEmptyRelationRemoval(names.Collections.Teams, names.Fields.Teams.Players, app),
+	)
+}
+
 func RegisterRoutes(app *pocketbase.PocketBase) {
 	app.OnServe().BindFunc(func(e *core.ServeEvent) error {
 		e.Router.PUT(
 			fmt.Sprintf("/api/ezbadminton/%s", names.Collections.MatchSets),
 			func(e *core.RequestEvent) error {
-				return PutMatchResult(e, app)
+				return PutMatchResult(e, withEventLogActor(e, app))
 			},
 		).Bind(apis.RequireAuth())
 
 		e.Router.POST(
 			fmt.Sprintf("/api/ezbadminton/%s", names.Collections.Competitions),
-			func(e *core.RequestEvent) error { return PostCompetitionMatches(e, app) },
+			func(e *core.RequestEvent) error { return PostCompetitionMatches(e, withEventLogActor(e, app)) },
+		).Bind(apis.RequireAuth())
+
+		e.Router.GET(
+			fmt.Sprintf("/api/ezbadminton/%s/partners", names.Collections.Competitions),
+			func(e *core.RequestEvent) error { return GetPartnerProposal(e, app) },
+		).Bind(apis.RequireAuth())
+
+		e.Router.POST(
+			fmt.Sprintf("/api/ezbadminton/%s/partners", names.Collections.Competitions),
+			func(e *core.RequestEvent) error { return PostPartnerPairings(e, withEventLogActor(e, app)) },
+		).Bind(apis.RequireAuth())
+
+		e.Router.POST(
+			fmt.Sprintf("/api/ezbadminton/%s/split", names.Collections.Competitions),
+			func(e *core.RequestEvent) error { return PostCompetitionSplit(e, withEventLogActor(e, app)) },
+		).Bind(apis.RequireAuth())
+
+		e.Router.GET(
+			"/api/ezbadminton/category_presets",
+			func(e *core.RequestEvent) error { return GetCategoryPresets(e) },
+		).Bind(apis.RequireAuth())
+
+		e.Router.POST(
+			"/api/ezbadminton/category_presets/apply",
+			func(e *core.RequestEvent) error { return PostCategoryPresets(e, withEventLogActor(e, app)) },
+		).Bind(apis.RequireAuth())
+
+		e.Router.POST(
+			fmt.Sprintf("/api/ezbadminton/%s/clone", names.Collections.Competitions),
+			func(e *core.RequestEvent) error { return PostCompetitionClone(e, withEventLogActor(e, app)) },
+		).Bind(apis.RequireAuth())
+
+		e.Router.POST(
+			fmt.Sprintf("/api/ezbadminton/%s/apply", names.Collections.CompetitionTemplates),
+			func(e *core.RequestEvent) error { return PostApplyCompetitionTemplate(e, withEventLogActor(e, app)) },
+		).Bind(apis.RequireAuth())
+
+		e.Router.POST(
+			fmt.Sprintf("/api/ezbadminton/%s/from-competitions", names.Collections.CompetitionTemplates),
+			func(e *core.RequestEvent) error { return PostCompetitionTemplate(e, withEventLogActor(e, app)) },
+		).Bind(apis.RequireAuth())
+
+		e.Router.POST(
+			fmt.Sprintf("/api/ezbadminton/%s/restore", names.Collections.CompetitionArchives),
+			func(e *core.RequestEvent) error { return PostRestoreCompetitionArchive(e, withEventLogActor(e, app)) },
+		).Bind(apis.RequireAuth())
+
+		e.Router.POST(
+			fmt.Sprintf("/api/ezbadminton/%s/undo", names.Collections.Snapshots),
+			func(e *core.RequestEvent) error { return PostUndo(e, withEventLogActor(e, app)) },
+		).Bind(apis.RequireAuth())
+
+		e.Router.POST(
+			fmt.Sprintf("/api/ezbadminton/%s/restore", names.Collections.Snapshots),
+			func(e *core.RequestEvent) error { return PostRestoreSnapshot(e, withEventLogActor(e, app)) },
+		).Bind(apis.RequireAuth())
+
+		e.Router.GET(
+			fmt.Sprintf("/api/ezbadminton/%s/player", names.Collections.MergeLogs),
+			func(e *core.RequestEvent) error { return GetMergeLogsOfPlayer(e, app) },
+		).Bind(apis.RequireAuth())
+
+		e.Router.GET(
+			fmt.Sprintf("/api/ezbadminton/%s/duplicates", names.Collections.Players),
+			func(e *core.RequestEvent) error { return GetDuplicatePlayers(e, app) },
+		).Bind(apis.RequireAuth())
+
+		e.Router.POST(
+			fmt.Sprintf("/api/ezbadminton/%s/merge", names.Collections.Players),
+			func(e *core.RequestEvent) error { return PostPlayerMerge(e, withEventLogActor(e, app)) },
+		).Bind(apis.RequireAuth())
+
+		e.Router.POST(
+			fmt.Sprintf("/api/ezbadminton/%s/import", names.Collections.Players),
+			func(e *core.RequestEvent) error { return PostPlayerImport(e, withEventLogActor(e, app)) },
+		).Bind(apis.RequireAuth())
+
+		for _, categoryCollection := range []string{names.Collections.AgeGroups, names.Collections.PlayingLevels} {
+			e.Router.GET(
+				fmt.Sprintf("/api/ezbadminton/%s/deletion-preview", categoryCollection),
+				func(e *core.RequestEvent) error { return GetCategoryDeletionPreview(e, categoryCollection, app) },
+			).Bind(apis.RequireAuth())
+		}
+
+		e.Router.GET(
+			fmt.Sprintf("/api/ezbadminton/%s/categorization-preview", names.Collections.Tournaments),
+			func(e *core.RequestEvent) error { return GetCategorizationPreview(e, app) },
+		).Bind(apis.RequireAuth())
+
+		e.Router.GET(
+			fmt.Sprintf("/api/ezbadminton/%s/state", names.Collections.EventLog),
+			func(e *core.RequestEvent) error { return GetEventLogState(e, app) },
 		).Bind(apis.RequireAuth())
 
 		e.Router.GET(
@@ -137,7 +283,70 @@ func RegisterRoutes(app *pocketbase.PocketBase) {
 	})
 }
 
-func OnTournamentSettingsUpdate(old *core.Record, updated *core.Record, dao core.App) error {
+// Runs the before function and the request action (e.Next) of a record request in one transaction.
+// Errors of the before function are sent as an ApiError. The request action is rolled back with
+// the changes of the before function when it fails.
+func runRequestInTransaction(e *core.RecordRequestEvent, before func(txApp core.App) error) error {
+	originalApp := e.App
+	defer func() { e.App = originalApp }()
+
+	var beforeErr error
+
+	err := e.App.RunInTransaction(func(txApp core.App) error {
+		e.App = txApp
+
+		if beforeErr = before(txApp); beforeErr != nil {
+			return beforeErr
+		}
+
+		return e.Next()
+	})
+
+	if beforeErr != nil {
+		return RespondError(e.RequestEvent, beforeErr)
+	}
+
+	// Errors of the request action are already in the format of the PocketBase API
+	return err
+}
+
+// Runs the record event in a transaction. The before and after functions are
+// optional and run in the same transaction before and after the event.
+func runRecordEventInTransaction(
+	e *core.RecordEvent,
+	before func(txApp core.App) error,
+	after func(txApp core.App) error,
+) error {
+	originalApp := e.App
+	defer func() { e.App = originalApp }()
+
+	return e.App.RunInTransaction(func(txApp core.App) error {
+		e.App = txApp
+
+		if before != nil {
+			if err := before(txApp); err != nil {
+				return err
+			}
+		}
+
+		if err := e.Next(); err != nil {
+			return err
+		}
+
+		if after != nil {
+			return after(txApp)
+		}
+
+		return nil
+	})
+}
+
+// The key of the CategorizationChangeResult in the response of a tournament update
+const CategorizationChangeResultKey = "categorizationChange"
+
+// OnTournamentSettingsUpdate merges or splits the competitions when the update disables or
+// enables a categorization. The returned result lists the merges of a disabled categorization.
+func OnTournamentSettingsUpdate(old *core.Record, updated *core.Record, dao core.App) (*CategorizationChangeResult, error) {
 	oldUseAgeGroups := old.GetBool(names.Fields.Tournaments.UseAgeGroups)
 	updatedUseAgeGroups := updated.GetBool(names.Fields.Tournaments.UseAgeGroups)
 
@@ -150,13 +359,14 @@ func OnTournamentSettingsUpdate(old *core.Record, updated *core.Record, dao core
 	ageGroupsEnabled := !oldUseAgeGroups && updatedUseAgeGroups
 	playingLevelsEnabled := !oldUsePlayingLevels && updatedUsePlayingLevels
 
-	if err := HandleDisabledCategorization(ageGroupsDisabled, playingLevelsDisabled, dao); err != nil {
-		return err
+	result, err := HandleDisabledCategorization(ageGroupsDisabled, playingLevelsDisabled, dao)
+	if err != nil {
+		return nil, err
 	}
 
 	if err := HandleEnabledCategorization(ageGroupsEnabled, playingLevelsEnabled, dao); err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return result, nil
 }
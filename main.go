@@ -21,6 +21,9 @@ func main() {
 		"with this option the server terminates itself when the client exits. Only works when the server is a child process of the client.",
 	)
 
+	app.RootCmd.AddCommand(NewImportCommand(app))
+	app.RootCmd.AddCommand(NewDoctorCommand(app))
+
 	RegisterHooks(app)
 	RegisterRoutes(app)
 
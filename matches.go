@@ -3,25 +3,31 @@ package main
 import (
 	"net/http"
 
-	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
-
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
 )
 
 // PutMatchResult processes PUT requests on the /api/ezbadminton/match_sets route.
 // It creates the MatchSet records and assigns them to a match. Also deletes the old
-// match sets of the match if they exist.
+// match sets of the match if they exist. The If-Match header can give the expected revision of the match.
 func PutMatchResult(e *core.RequestEvent, dao core.App) error {
 	endTime := e.Request.URL.Query().Get("endTime")
 	matchId := e.Request.URL.Query().Get("match")
 
+	if endTime == "" {
+		return RespondError(e, missingFieldError("endTime"))
+	}
+	if matchId == "" {
+		return RespondError(e, missingFieldError("match"))
+	}
+
 	info, err := e.RequestInfo()
-	if endTime == "" || matchId == "" || err != nil {
-		return e.NoContent(http.StatusBadRequest)
+	if err != nil {
+		return RespondError(e, invalidBodyError())
 	}
 	resultsData, resultsExist := info.Body["results"]
 	if !resultsExist {
-		return e.NoContent(http.StatusBadRequest)
+		return RespondError(e, missingFieldError("results"))
 	}
 
 	var resultsDataArray []interface{}
@@ -30,7 +36,7 @@ func PutMatchResult(e *core.RequestEvent, dao core.App) error {
 	case []interface{}:
 		resultsDataArray = val
 	default:
-		return e.NoContent(http.StatusBadRequest)
+		return RespondError(e, invalidSetScoreError("the results have to be a list of points"))
 	}
 
 	var resultArray []int = make([]int, 0, len(resultsDataArray))
@@ -38,38 +44,37 @@ func PutMatchResult(e *core.RequestEvent, dao core.App) error {
 	for _, result := range resultsDataArray {
 		switch val := result.(type) {
 		case float64:
+			if val < 0 || val != float64(int(val)) {
+				return RespondError(e, invalidSetScoreError("the points have to be non-negative whole numbers"))
+			}
 			resultArray = append(resultArray, int(val))
 		default:
-			return e.NoContent(http.StatusBadRequest)
+			return RespondError(e, invalidSetScoreError("the points have to be numbers"))
 		}
 	}
 
 	numScores := len(resultArray)
 
 	if numScores == 0 || numScores%2 != 0 {
-		return e.NoContent(http.StatusBadRequest)
+		return RespondError(e, invalidSetScoreError("the results need the points of both teams for at least one set"))
 	}
 
 	transactionError := dao.RunInTransaction(func(txDao core.App) error {
-		matchSetCollection, err := txDao.FindCollectionByNameOrId(names.Collections.MatchSets)
+		match, err := FindMatch(matchId, txDao)
 		if err != nil {
 			return err
 		}
-		match, err := txDao.FindRecordById(names.Collections.MatchData, matchId)
-		if err != nil {
+		if err := checkRevision(e, match.Record); err != nil {
 			return err
 		}
 
-		txDao.ExpandRecord(match, []string{names.Fields.MatchData.Sets}, nil)
-		oldSets := match.ExpandedAll(names.Fields.MatchData.Sets)
-
 		newSetIds := make([]string, 0, 2)
 
 		for i := 0; i < numScores; i += 2 {
-			newSet := core.NewRecord(matchSetCollection)
-
-			newSet.Set(names.Fields.MatchSets.Team1Points, resultArray[i])
-			newSet.Set(names.Fields.MatchSets.Team2Points, resultArray[i+1])
+			newSet, err := NewMatchSet(resultArray[i], resultArray[i+1], txDao)
+			if err != nil {
+				return err
+			}
 
 			if err := txDao.Save(newSet); err != nil {
 				return err
@@ -78,41 +83,23 @@ func PutMatchResult(e *core.RequestEvent, dao core.App) error {
 			newSetIds = append(newSetIds, newSet.Id)
 		}
 
-		match.Set(names.Fields.MatchData.EndTime, endTime)
-		match.Set(names.Fields.MatchData.Sets, newSetIds)
-		if err := txDao.Save(match); err != nil {
-			return err
-		}
-
-		if err := ProcessAsModels(oldSets, txDao.Delete); err != nil {
-			return err
-		}
-
-		return nil
+		// The date field stores an end time that is not a valid date as an empty date
+		matchEndTime, _ := types.ParseDateTime(endTime)
+		match.SetEndTime(matchEndTime)
+		// The old sets are removed as orphans of the match
+		match.SetSetIds(newSetIds)
+		return txDao.Save(match)
 	})
 
 	if transactionError != nil {
-		return e.NoContent(http.StatusInternalServerError)
+		return RespondError(e, transactionError)
 	}
 
 	return e.NoContent(http.StatusOK)
 }
 
-// HandleAfterUpdatedMatch deletes the match's sets if they have been removed from the match
-func HandleAfterUpdatedMatch(updatedMatch *core.Record, oldMatch *core.Record, dao core.App) error {
-	updatedSetIds := updatedMatch.GetStringSlice(names.Fields.MatchData.Sets)
-	oldSetIds := oldMatch.GetStringSlice(names.Fields.MatchData.Sets)
-
-	numUpdatedSets := len(updatedSetIds)
-	numOldSets := len(oldSetIds)
-
-	if numUpdatedSets > 0 || numOldSets == 0 {
-		return nil
-	}
-
-	if err := DeleteModelsById(names.Collections.MatchSets, oldSetIds, dao); err != nil {
-		return err
-	}
-
-	return nil
+// Returns an INVALID_SET_SCORE error about the results field
+func invalidSetScoreError(message string) *ApiError {
+	return NewApiError(http.StatusBadRequest, ErrorCodeInvalidSetScore, "the set score is invalid").
+		WithDetail("results", FieldErrorCodeInvalid, message)
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// GetMergeLogsOfPlayer handles GET requests to the /api/ezbadminton/merge_logs/player route.
+// It responds with the merge logs that affected the player given by the "player" query parameter.
+// A player is affected when they lost their partner, got a new team of their own or
+// caused another team to be dissolved.
+func GetMergeLogsOfPlayer(e *core.RequestEvent, dao core.App) error {
+	playerId := e.Request.URL.Query().Get("player")
+	if playerId == "" {
+		return RespondError(e, missingFieldError("player"))
+	}
+
+	mergeLogs := []*core.Record{}
+	err := dao.RecordQuery(names.Collections.MergeLogs).
+		OrderBy(names.Fields.MergeLogs.Created + " DESC").
+		All(&mergeLogs)
+	if err != nil {
+		return RespondError(e, err)
+	}
+
+	logsOfPlayer := []*core.Record{}
+	for _, mergeLog := range mergeLogs {
+		report := MergeReport{}
+		if err := mergeLog.UnmarshalJSONField(names.Fields.MergeLogs.Report, &report); err != nil {
+			return RespondError(e, err)
+		}
+
+		if isPlayerAffectedByMerge(playerId, report) {
+			logsOfPlayer = append(logsOfPlayer, mergeLog)
+		}
+	}
+
+	return e.JSON(http.StatusOK, logsOfPlayer)
+}
+
+// Stores the report of a merge that has been carried out
+func saveMergeLog(report MergeReport, dao core.App) error {
+	mergeLogCollection, err := dao.FindCollectionByNameOrId(names.Collections.MergeLogs)
+	if err != nil {
+		return err
+	}
+
+	mergeLog := core.NewRecord(mergeLogCollection)
+	mergeLog.Set(names.Fields.MergeLogs.MergeTarget, report.MergeTarget)
+	mergeLog.Set(names.Fields.MergeLogs.Report, report)
+
+	return dao.Save(mergeLog)
+}
+
+func isPlayerAffectedByMerge(playerId string, report MergeReport) bool {
+	if slices.Contains(report.SplitPlayers, playerId) {
+		return true
+	}
+
+	for _, lostPartner := range report.LostPartners {
+		if lostPartner.Player == playerId || lostPartner.Partner == playerId {
+			return true
+		}
+	}
+
+	for _, conflict := range report.Conflicts {
+		if conflict.Player == playerId {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		tournamentCollection, err := app.FindCollectionByNameOrId(names.Collections.Tournaments)
+		if err != nil {
+			return err
+		}
+
+		// A value of 0 means that players can enter any number of competitions
+		tournamentCollection.Fields.Add(&core.NumberField{
+			Name:    names.Fields.Tournaments.MaxEntriesPerPlayer,
+			Min:     types.Pointer(0.0),
+			OnlyInt: true,
+		})
+
+		return app.Save(tournamentCollection)
+	}, func(app core.App) error {
+		tournamentCollection, err := app.FindCollectionByNameOrId(names.Collections.Tournaments)
+		if err != nil {
+			return err
+		}
+
+		tournamentCollection.Fields.RemoveByName(names.Fields.Tournaments.MaxEntriesPerPlayer)
+
+		return app.Save(tournamentCollection)
+	})
+}
@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		playerCollection, err := app.FindCollectionByNameOrId(names.Collections.Players)
+		if err != nil {
+			return err
+		}
+		playingLevelCollection, err := app.FindCollectionByNameOrId(names.Collections.PlayingLevels)
+		if err != nil {
+			return err
+		}
+
+		playerCollection.Fields.Add(
+			&core.SelectField{
+				Name:      names.Fields.Players.Gender,
+				Values:    []string{"female", "male"},
+				MaxSelect: 1,
+			},
+			&core.RelationField{
+				Name:         names.Fields.Players.PlayingLevel,
+				CollectionId: playingLevelCollection.Id,
+				MaxSelect:    1,
+			},
+		)
+
+		return app.Save(playerCollection)
+	}, func(app core.App) error {
+		playerCollection, err := app.FindCollectionByNameOrId(names.Collections.Players)
+		if err != nil {
+			return err
+		}
+
+		playerCollection.Fields.RemoveByName(names.Fields.Players.Gender)
+		playerCollection.Fields.RemoveByName(names.Fields.Players.PlayingLevel)
+
+		return app.Save(playerCollection)
+	})
+}
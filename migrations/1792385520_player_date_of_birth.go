@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		playerCollection, err := app.FindCollectionByNameOrId(names.Collections.Players)
+		if err != nil {
+			return err
+		}
+
+		playerCollection.Fields.Add(&core.DateField{
+			Name: names.Fields.Players.DateOfBirth,
+		})
+
+		return app.Save(playerCollection)
+	}, func(app core.App) error {
+		playerCollection, err := app.FindCollectionByNameOrId(names.Collections.Players)
+		if err != nil {
+			return err
+		}
+
+		playerCollection.Fields.RemoveByName(names.Fields.Players.DateOfBirth)
+
+		return app.Save(playerCollection)
+	})
+}
@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"math"
+
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		competitionCollection, err := app.FindCollectionByNameOrId(names.Collections.Competitions)
+		if err != nil {
+			return err
+		}
+		teamCollection, err := app.FindCollectionByNameOrId(names.Collections.Teams)
+		if err != nil {
+			return err
+		}
+
+		competitionCollection.Fields.Add(
+			// A value of 0 means that the number of entries is not limited
+			&core.NumberField{
+				Name:    names.Fields.Competitions.MaxEntries,
+				Min:     types.Pointer(0.0),
+				OnlyInt: true,
+			},
+			&core.RelationField{
+				Name:         names.Fields.Competitions.Waitlist,
+				CollectionId: teamCollection.Id,
+				MaxSelect:    math.MaxInt32,
+			},
+		)
+
+		return app.Save(competitionCollection)
+	}, func(app core.App) error {
+		competitionCollection, err := app.FindCollectionByNameOrId(names.Collections.Competitions)
+		if err != nil {
+			return err
+		}
+
+		competitionCollection.Fields.RemoveByName(names.Fields.Competitions.MaxEntries)
+		competitionCollection.Fields.RemoveByName(names.Fields.Competitions.Waitlist)
+
+		return app.Save(competitionCollection)
+	})
+}
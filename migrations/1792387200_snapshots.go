@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		snapshotCollection := core.NewBaseCollection(names.Collections.Snapshots)
+
+		// Snapshots can only be created and restored by the server
+		snapshotCollection.ListRule = types.Pointer("@request.auth.id != \"\"")
+		snapshotCollection.ViewRule = types.Pointer("@request.auth.id != \"\"")
+
+		snapshotCollection.Fields.Add(
+			&core.TextField{
+				Name:     names.Fields.Snapshots.Operation,
+				Required: true,
+			},
+			&core.JSONField{
+				Name:    names.Fields.Snapshots.Content,
+				MaxSize: 64 << 20,
+			},
+			&core.AutodateField{
+				Name:     names.Fields.Snapshots.Created,
+				OnCreate: true,
+			},
+		)
+
+		return app.Save(snapshotCollection)
+	}, func(app core.App) error {
+		snapshotCollection, err := app.FindCollectionByNameOrId(names.Collections.Snapshots)
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(snapshotCollection)
+	})
+}
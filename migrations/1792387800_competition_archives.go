@@ -0,0 +1,77 @@
+package migrations
+
+import (
+	"math"
+
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		competitionCollection, err := app.FindCollectionByNameOrId(names.Collections.Competitions)
+		if err != nil {
+			return err
+		}
+		matchDataCollection, err := app.FindCollectionByNameOrId(names.Collections.MatchData)
+		if err != nil {
+			return err
+		}
+		teamCollection, err := app.FindCollectionByNameOrId(names.Collections.Teams)
+		if err != nil {
+			return err
+		}
+
+		archiveCollection := core.NewBaseCollection(names.Collections.CompetitionArchives)
+
+		// Archives are only created and restored by the server
+		archiveCollection.ListRule = types.Pointer("@request.auth.id != \"\"")
+		archiveCollection.ViewRule = types.Pointer("@request.auth.id != \"\"")
+
+		archiveCollection.Fields.Add(
+			&core.RelationField{
+				Name:          names.Fields.CompetitionArchives.Competition,
+				CollectionId:  competitionCollection.Id,
+				MaxSelect:     1,
+				Required:      true,
+				CascadeDelete: true,
+			},
+			&core.RelationField{
+				Name:         names.Fields.CompetitionArchives.Matches,
+				CollectionId: matchDataCollection.Id,
+				MaxSelect:    math.MaxInt32,
+			},
+			&core.RelationField{
+				Name:         names.Fields.CompetitionArchives.Draw,
+				CollectionId: teamCollection.Id,
+				MaxSelect:    math.MaxInt32,
+			},
+			&core.RelationField{
+				Name:         names.Fields.CompetitionArchives.Seeds,
+				CollectionId: teamCollection.Id,
+				MaxSelect:    math.MaxInt32,
+			},
+			// The time that the first match of the archived run started
+			&core.DateField{
+				Name: names.Fields.CompetitionArchives.StartTime,
+			},
+			// The time that the run was cancelled
+			&core.AutodateField{
+				Name:     names.Fields.CompetitionArchives.Created,
+				OnCreate: true,
+			},
+		)
+
+		return app.Save(archiveCollection)
+	}, func(app core.App) error {
+		archiveCollection, err := app.FindCollectionByNameOrId(names.Collections.CompetitionArchives)
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(archiveCollection)
+	})
+}
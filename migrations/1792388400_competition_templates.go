@@ -0,0 +1,78 @@
+package migrations
+
+import (
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// The standard setups that every new tournament starts with
+var standardCompetitionTemplates = []struct {
+	name         string
+	competitions string
+}{
+	{
+		name: "U15 singles, 4 groups, top 2 to KO, 1x21 points",
+		competitions: `[
+			{"GenderCategory": "male", "TeamSize": 1, "AgeGroup": "U15", "TournamentModeSettings": {"type": "GroupKnockout", "seedingMode": "tiered", "knockOutMode": "single", "numGroups": 4, "numQualifications": 8, "winningPoints": 21, "winningSets": 1, "maxPoints": 30, "twoPointMargin": true}},
+			{"GenderCategory": "female", "TeamSize": 1, "AgeGroup": "U15", "TournamentModeSettings": {"type": "GroupKnockout", "seedingMode": "tiered", "knockOutMode": "single", "numGroups": 4, "numQualifications": 8, "winningPoints": 21, "winningSets": 1, "maxPoints": 30, "twoPointMargin": true}}
+		]`,
+	},
+	{
+		name: "All disciplines, single elimination, 2x21 points",
+		competitions: `[
+			{"GenderCategory": "male", "TeamSize": 1, "TournamentModeSettings": {"type": "SingleElimination", "seedingMode": "tiered", "winningPoints": 21, "winningSets": 2, "maxPoints": 30, "twoPointMargin": true}},
+			{"GenderCategory": "female", "TeamSize": 1, "TournamentModeSettings": {"type": "SingleElimination", "seedingMode": "tiered", "winningPoints": 21, "winningSets": 2, "maxPoints": 30, "twoPointMargin": true}},
+			{"GenderCategory": "male", "TeamSize": 2, "TournamentModeSettings": {"type": "SingleElimination", "seedingMode": "tiered", "winningPoints": 21, "winningSets": 2, "maxPoints": 30, "twoPointMargin": true}},
+			{"GenderCategory": "female", "TeamSize": 2, "TournamentModeSettings": {"type": "SingleElimination", "seedingMode": "tiered", "winningPoints": 21, "winningSets": 2, "maxPoints": 30, "twoPointMargin": true}},
+			{"GenderCategory": "mixed", "TeamSize": 2, "TournamentModeSettings": {"type": "SingleElimination", "seedingMode": "tiered", "winningPoints": 21, "winningSets": 2, "maxPoints": 30, "twoPointMargin": true}}
+		]`,
+	},
+}
+
+func init() {
+	m.Register(func(app core.App) error {
+		templateCollection := core.NewBaseCollection(names.Collections.CompetitionTemplates)
+
+		templateCollection.ListRule = types.Pointer("@request.auth.id != \"\"")
+		templateCollection.ViewRule = types.Pointer("@request.auth.id != \"\"")
+		templateCollection.CreateRule = types.Pointer("@request.auth.id != \"\"")
+		templateCollection.UpdateRule = types.Pointer("@request.auth.id != \"\"")
+		templateCollection.DeleteRule = types.Pointer("@request.auth.id != \"\"")
+
+		templateCollection.Fields.Add(
+			&core.TextField{
+				Name:     names.Fields.CompetitionTemplates.Name,
+				Required: true,
+			},
+			&core.JSONField{
+				Name: names.Fields.CompetitionTemplates.Competitions,
+			},
+		)
+
+		if err := app.Save(templateCollection); err != nil {
+			return err
+		}
+
+		for _, standardTemplate := range standardCompetitionTemplates {
+			template := core.NewRecord(templateCollection)
+			template.Set(names.Fields.CompetitionTemplates.Name, standardTemplate.name)
+			template.Set(names.Fields.CompetitionTemplates.Competitions, standardTemplate.competitions)
+
+			if err := app.Save(template); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		templateCollection, err := app.FindCollectionByNameOrId(names.Collections.CompetitionTemplates)
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(templateCollection)
+	})
+}
@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		mergeLogCollection := core.NewBaseCollection(names.Collections.MergeLogs)
+
+		// Merge logs are only written by the server
+		mergeLogCollection.ListRule = types.Pointer("@request.auth.id != \"\"")
+		mergeLogCollection.ViewRule = types.Pointer("@request.auth.id != \"\"")
+
+		mergeLogCollection.Fields.Add(
+			// Not a relation so that the log outlives the merged competition
+			&core.TextField{
+				Name:     names.Fields.MergeLogs.MergeTarget,
+				Required: true,
+			},
+			&core.JSONField{
+				Name:    names.Fields.MergeLogs.Report,
+				MaxSize: 16 << 20,
+			},
+			&core.AutodateField{
+				Name:     names.Fields.MergeLogs.Created,
+				OnCreate: true,
+			},
+		)
+
+		mergeLogCollection.AddIndex("idx_merge_logs_merge_target", false, names.Fields.MergeLogs.MergeTarget, "")
+
+		return app.Save(mergeLogCollection)
+	}, func(app core.App) error {
+		mergeLogCollection, err := app.FindCollectionByNameOrId(names.Collections.MergeLogs)
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(mergeLogCollection)
+	})
+}
@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"fmt"
+
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// One row per relation of a record in an indexed multi-relation field.
+		// The primary key serves the reverse lookups from a related record to its holders.
+		_, err := app.DB().NewQuery(fmt.Sprintf(`
+			CREATE TABLE {{%[1]s}} (
+				[[collectionName]] TEXT NOT NULL,
+				[[fieldName]]      TEXT NOT NULL,
+				[[recordId]]       TEXT NOT NULL,
+				[[relationId]]     TEXT NOT NULL,
+				PRIMARY KEY ([[collectionName]], [[fieldName]], [[relationId]], [[recordId]])
+			);
+			CREATE INDEX {{idx_%[1]s_record}} ON {{%[1]s}} ([[collectionName]], [[fieldName]], [[recordId]]);
+		`, names.Tables.RelationIndex)).Execute()
+		if err != nil {
+			return err
+		}
+
+		for _, relation := range []struct {
+			collectionName string
+			fieldName      string
+		}{
+			{names.Collections.Competitions, names.Fields.Competitions.Registrations},
+			{names.Collections.Competitions, names.Fields.Competitions.Matches},
+			{names.Collections.Teams, names.Fields.Teams.Players},
+		} {
+			_, err := app.DB().NewQuery(fmt.Sprintf(`
+				INSERT OR IGNORE INTO {{%[1]s}} ([[collectionName]], [[fieldName]], [[recordId]], [[relationId]])
+				SELECT {:collectionName}, {:fieldName}, [[record.id]], [[relation.value]]
+				FROM {{%[2]s}} [[record]], json_each([[record.%[3]s]]) [[relation]]
+			`, names.Tables.RelationIndex, relation.collectionName, relation.fieldName)).
+				Bind(map[string]any{
+					"collectionName": relation.collectionName,
+					"fieldName":      relation.fieldName,
+				}).
+				Execute()
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		_, err := app.DB().DropTable(names.Tables.RelationIndex).Execute()
+		return err
+	})
+}
@@ -0,0 +1,103 @@
+package migrations
+
+import (
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		eventLogCollection := core.NewBaseCollection(names.Collections.EventLog)
+
+		// The event log is only written by the server and is never changed
+		eventLogCollection.ListRule = types.Pointer("@request.auth.id != \"\"")
+		eventLogCollection.ViewRule = types.Pointer("@request.auth.id != \"\"")
+
+		eventLogCollection.Fields.Add(
+			&core.TextField{
+				Name:     names.Fields.EventLog.Type,
+				Required: true,
+			},
+			// Not relations so that the log outlives the records
+			&core.TextField{
+				Name:     names.Fields.EventLog.Collection,
+				Required: true,
+			},
+			&core.TextField{
+				Name:     names.Fields.EventLog.Record,
+				Required: true,
+			},
+			&core.JSONField{
+				Name:    names.Fields.EventLog.Data,
+				MaxSize: 16 << 20,
+			},
+			&core.TextField{
+				Name: names.Fields.EventLog.Actor,
+			},
+			&core.AutodateField{
+				Name:     names.Fields.EventLog.Created,
+				OnCreate: true,
+			},
+		)
+
+		eventLogCollection.AddIndex("idx_event_log_created", false, names.Fields.EventLog.Created, "")
+		eventLogCollection.AddIndex(
+			"idx_event_log_record",
+			false,
+			names.Fields.EventLog.Collection+", "+names.Fields.EventLog.Record,
+			"",
+		)
+
+		if err := app.Save(eventLogCollection); err != nil {
+			return err
+		}
+
+		// The existing records are the initial state of the log
+		for _, collectionName := range []string{
+			names.Collections.AgeGroups,
+			names.Collections.PlayingLevels,
+			names.Collections.Clubs,
+			names.Collections.Players,
+			names.Collections.Tournaments,
+			names.Collections.TournamentModeSettings,
+			names.Collections.TieBreakers,
+			names.Collections.Gymnasiums,
+			names.Collections.Courts,
+			names.Collections.MatchSets,
+			names.Collections.MatchData,
+			names.Collections.Teams,
+			names.Collections.Competitions,
+			names.Collections.CompetitionArchives,
+			names.Collections.MergeLogs,
+		} {
+			records, err := app.FindAllRecords(collectionName)
+			if err != nil {
+				return err
+			}
+
+			for _, record := range records {
+				event := core.NewRecord(eventLogCollection)
+				event.Set(names.Fields.EventLog.Type, names.EventTypeInitialState)
+				event.Set(names.Fields.EventLog.Collection, collectionName)
+				event.Set(names.Fields.EventLog.Record, record.Id)
+				event.Set(names.Fields.EventLog.Data, record.FieldsData())
+
+				if err := app.Save(event); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		eventLogCollection, err := app.FindCollectionByNameOrId(names.Collections.EventLog)
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(eventLogCollection)
+	})
+}
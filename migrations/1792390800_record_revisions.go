@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	// The collections whose records have a revision mapped to the name of the revision field
+	revisionFields := map[string]string{
+		names.Collections.Competitions: names.Fields.Competitions.Revision,
+		names.Collections.MatchData:    names.Fields.MatchData.Revision,
+		names.Collections.Teams:        names.Fields.Teams.Revision,
+	}
+
+	m.Register(func(app core.App) error {
+		for collectionName, fieldName := range revisionFields {
+			collection, err := app.FindCollectionByNameOrId(collectionName)
+			if err != nil {
+				return err
+			}
+
+			// The revision is counted up by the server on each update
+			collection.Fields.Add(&core.NumberField{
+				Name:    fieldName,
+				Min:     types.Pointer(0.0),
+				OnlyInt: true,
+			})
+
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		for collectionName, fieldName := range revisionFields {
+			collection, err := app.FindCollectionByNameOrId(collectionName)
+			if err != nil {
+				return err
+			}
+
+			collection.Fields.RemoveByName(fieldName)
+
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
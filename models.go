@@ -0,0 +1,392 @@
+package main
+
+import (
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// The typed models of the tournament records. Each model proxies a record and
+// accesses its fields only through the schema names.
+//
+// The models are saved and deleted like records (dao.Save(model)) and can be
+// loaded by record queries (dao.RecordQuery(...).All(&models)).
+
+type Competition struct{ core.BaseRecordProxy }
+type Team struct{ core.BaseRecordProxy }
+type Match struct{ core.BaseRecordProxy }
+type MatchSet struct{ core.BaseRecordProxy }
+type Player struct{ core.BaseRecordProxy }
+type Court struct{ core.BaseRecordProxy }
+type Tournament struct{ core.BaseRecordProxy }
+
+// The settings are only read by the clients. The server does not access their fields.
+type TournamentModeSettings struct{ core.BaseRecordProxy }
+
+// The pointer type of a model
+type modelPointer[T any] interface {
+	*T
+	core.RecordProxy
+}
+
+// WrapRecord returns the model that proxies the record. A nil record returns a nil model.
+func WrapRecord[T any, M modelPointer[T]](record *core.Record) M {
+	if record == nil {
+		return nil
+	}
+
+	model := M(new(T))
+	model.SetProxyRecord(record)
+	return model
+}
+
+// WrapRecords returns the models that proxy the records
+func WrapRecords[T any, M modelPointer[T]](records []*core.Record) []M {
+	models := make([]M, 0, len(records))
+	for _, record := range records {
+		models = append(models, WrapRecord[T, M](record))
+	}
+	return models
+}
+
+// Fetches the record of the model. A missing record returns a not found ApiError.
+func findModel[T any, M modelPointer[T]](collectionName string, id string, dao core.App) (M, error) {
+	record, err := FetchRecord(collectionName, id, dao)
+	if err != nil {
+		return nil, err
+	}
+
+	return WrapRecord[T, M](record), nil
+}
+
+// Creates an unsaved model in the collection
+func newModel[T any, M modelPointer[T]](collectionName string, dao core.App) (M, error) {
+	collection, err := dao.FindCollectionByNameOrId(collectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	return WrapRecord[T, M](core.NewRecord(collection)), nil
+}
+
+func FindCompetition(id string, dao core.App) (*Competition, error) {
+	return findModel[Competition](names.Collections.Competitions, id, dao)
+}
+
+func FindTeam(id string, dao core.App) (*Team, error) {
+	return findModel[Team](names.Collections.Teams, id, dao)
+}
+
+func FindMatch(id string, dao core.App) (*Match, error) {
+	return findModel[Match](names.Collections.MatchData, id, dao)
+}
+
+func FindMatchSet(id string, dao core.App) (*MatchSet, error) {
+	return findModel[MatchSet](names.Collections.MatchSets, id, dao)
+}
+
+func FindPlayer(id string, dao core.App) (*Player, error) {
+	return findModel[Player](names.Collections.Players, id, dao)
+}
+
+func FindCourt(id string, dao core.App) (*Court, error) {
+	return findModel[Court](names.Collections.Courts, id, dao)
+}
+
+// FindTournament returns the tournament model. See FetchTournament.
+func FindTournament(dao core.App) (*Tournament, error) {
+	tournament, err := FetchTournament(dao)
+	if err != nil {
+		return nil, err
+	}
+
+	return WrapRecord[Tournament](tournament), nil
+}
+
+func NewMatchSet(team1Points int, team2Points int, dao core.App) (*MatchSet, error) {
+	set, err := newModel[MatchSet](names.Collections.MatchSets, dao)
+	if err != nil {
+		return nil, err
+	}
+
+	set.SetTeam1Points(team1Points)
+	set.SetTeam2Points(team2Points)
+
+	return set, nil
+}
+
+// Competition
+
+func (c *Competition) TeamSize() int {
+	return c.GetInt(names.Fields.Competitions.TeamSize)
+}
+
+func (c *Competition) GenderCategory() string {
+	return c.GetString(names.Fields.Competitions.GenderCategory)
+}
+
+func (c *Competition) AgeGroupId() string {
+	return c.GetString(names.Fields.Competitions.AgeGroup)
+}
+
+func (c *Competition) PlayingLevelId() string {
+	return c.GetString(names.Fields.Competitions.PlayingLevel)
+}
+
+// MaxEntries returns the maximum number of registrations. 0 means unlimited.
+func (c *Competition) MaxEntries() int {
+	return c.GetInt(names.Fields.Competitions.MaxEntries)
+}
+
+// HasFreePlace returns wether another team can be registered
+func (c *Competition) HasFreePlace() bool {
+	return c.MaxEntries() == 0 || len(c.RegistrationIds()) < c.MaxEntries()
+}
+
+// IsRunning returns wether the competition's matches have been created
+func (c *Competition) IsRunning() bool {
+	return len(c.MatchIds()) != 0
+}
+
+func (c *Competition) Revision() int {
+	return c.GetInt(names.Fields.Competitions.Revision)
+}
+
+func (c *Competition) RegistrationIds() []string {
+	return c.GetStringSlice(names.Fields.Competitions.Registrations)
+}
+
+func (c *Competition) SetRegistrationIds(ids []string) {
+	c.Set(names.Fields.Competitions.Registrations, ids)
+}
+
+func (c *Competition) WaitlistIds() []string {
+	return c.GetStringSlice(names.Fields.Competitions.Waitlist)
+}
+
+func (c *Competition) SetWaitlistIds(ids []string) {
+	c.Set(names.Fields.Competitions.Waitlist, ids)
+}
+
+func (c *Competition) DrawIds() []string {
+	return c.GetStringSlice(names.Fields.Competitions.Draw)
+}
+
+func (c *Competition) SetDrawIds(ids []string) {
+	c.Set(names.Fields.Competitions.Draw, ids)
+}
+
+func (c *Competition) SeedIds() []string {
+	return c.GetStringSlice(names.Fields.Competitions.Seeds)
+}
+
+func (c *Competition) SetSeedIds(ids []string) {
+	c.Set(names.Fields.Competitions.Seeds, ids)
+}
+
+func (c *Competition) MatchIds() []string {
+	return c.GetStringSlice(names.Fields.Competitions.Matches)
+}
+
+func (c *Competition) TieBreakerIds() []string {
+	return c.GetStringSlice(names.Fields.Competitions.TieBreakers)
+}
+
+// Registrations returns the expanded registered teams
+func (c *Competition) Registrations() []*Team {
+	return WrapRecords[Team](c.ExpandedAll(names.Fields.Competitions.Registrations))
+}
+
+// Waitlist returns the expanded waitlisted teams
+func (c *Competition) Waitlist() []*Team {
+	return WrapRecords[Team](c.ExpandedAll(names.Fields.Competitions.Waitlist))
+}
+
+// Matches returns the expanded matches
+func (c *Competition) Matches() []*Match {
+	return WrapRecords[Match](c.ExpandedAll(names.Fields.Competitions.Matches))
+}
+
+// TournamentModeSettings returns the expanded settings
+func (c *Competition) TournamentModeSettings() *TournamentModeSettings {
+	return WrapRecord[TournamentModeSettings](c.ExpandedOne(names.Fields.Competitions.TournamentModeSettings))
+}
+
+// Team
+
+func (t *Team) Revision() int {
+	return t.GetInt(names.Fields.Teams.Revision)
+}
+
+func (t *Team) PlayerIds() []string {
+	return t.GetStringSlice(names.Fields.Teams.Players)
+}
+
+func (t *Team) SetPlayerIds(ids []string) {
+	t.Set(names.Fields.Teams.Players, ids)
+}
+
+// Players returns the expanded players
+func (t *Team) Players() []*Player {
+	return WrapRecords[Player](t.ExpandedAll(names.Fields.Teams.Players))
+}
+
+// SharesPlayerWith returns wether one of the team's players is also in the other team
+func (t *Team) SharesPlayerWith(other *Team) bool {
+	otherPlayerIds := other.PlayerIds()
+	for _, playerId := range t.PlayerIds() {
+		for _, otherPlayerId := range otherPlayerIds {
+			if playerId == otherPlayerId {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Match
+
+func (m *Match) Revision() int {
+	return m.GetInt(names.Fields.MatchData.Revision)
+}
+
+func (m *Match) CourtId() string {
+	return m.GetString(names.Fields.MatchData.Court)
+}
+
+func (m *Match) SetCourtId(id string) {
+	m.Set(names.Fields.MatchData.Court, id)
+}
+
+func (m *Match) SetIds() []string {
+	return m.GetStringSlice(names.Fields.MatchData.Sets)
+}
+
+func (m *Match) SetSetIds(ids []string) {
+	m.Set(names.Fields.MatchData.Sets, ids)
+}
+
+// Sets returns the expanded match sets
+func (m *Match) Sets() []*MatchSet {
+	return WrapRecords[MatchSet](m.ExpandedAll(names.Fields.MatchData.Sets))
+}
+
+// Court returns the expanded court
+func (m *Match) Court() *Court {
+	return WrapRecord[Court](m.ExpandedOne(names.Fields.MatchData.Court))
+}
+
+func (m *Match) StartTime() types.DateTime {
+	return m.GetDateTime(names.Fields.MatchData.StartTime)
+}
+
+func (m *Match) SetStartTime(startTime types.DateTime) {
+	m.Set(names.Fields.MatchData.StartTime, startTime)
+}
+
+func (m *Match) EndTime() types.DateTime {
+	return m.GetDateTime(names.Fields.MatchData.EndTime)
+}
+
+func (m *Match) SetEndTime(endTime types.DateTime) {
+	m.Set(names.Fields.MatchData.EndTime, endTime)
+}
+
+// MatchSet
+
+func (s *MatchSet) Team1Points() int {
+	return s.GetInt(names.Fields.MatchSets.Team1Points)
+}
+
+func (s *MatchSet) SetTeam1Points(points int) {
+	s.Set(names.Fields.MatchSets.Team1Points, points)
+}
+
+func (s *MatchSet) Team2Points() int {
+	return s.GetInt(names.Fields.MatchSets.Team2Points)
+}
+
+func (s *MatchSet) SetTeam2Points(points int) {
+	s.Set(names.Fields.MatchSets.Team2Points, points)
+}
+
+// Player
+
+func (p *Player) FirstName() string {
+	return p.GetString(names.Fields.Players.FirstName)
+}
+
+func (p *Player) LastName() string {
+	return p.GetString(names.Fields.Players.LastName)
+}
+
+func (p *Player) Notes() string {
+	return p.GetString(names.Fields.Players.Notes)
+}
+
+func (p *Player) Status() string {
+	return p.GetString(names.Fields.Players.Status)
+}
+
+func (p *Player) SetStatus(status string) {
+	p.Set(names.Fields.Players.Status, status)
+}
+
+func (p *Player) ClubId() string {
+	return p.GetString(names.Fields.Players.Club)
+}
+
+func (p *Player) Gender() string {
+	return p.GetString(names.Fields.Players.Gender)
+}
+
+func (p *Player) PlayingLevelId() string {
+	return p.GetString(names.Fields.Players.PlayingLevel)
+}
+
+func (p *Player) DateOfBirth() types.DateTime {
+	return p.GetDateTime(names.Fields.Players.DateOfBirth)
+}
+
+// Court
+
+func (c *Court) GymnasiumId() string {
+	return c.GetString(names.Fields.Courts.Gymnasium)
+}
+
+// Tournament
+
+func (t *Tournament) Title() string {
+	return t.GetString(names.Fields.Tournaments.Title)
+}
+
+func (t *Tournament) UseAgeGroups() bool {
+	return t.GetBool(names.Fields.Tournaments.UseAgeGroups)
+}
+
+func (t *Tournament) UsePlayingLevels() bool {
+	return t.GetBool(names.Fields.Tournaments.UsePlayingLevels)
+}
+
+func (t *Tournament) DontReprintGameSheets() bool {
+	return t.GetBool(names.Fields.Tournaments.DontReprintGameSheets)
+}
+
+func (t *Tournament) PrintQrCodes() bool {
+	return t.GetBool(names.Fields.Tournaments.PrintQrCodes)
+}
+
+func (t *Tournament) PlayerRestTime() int {
+	return t.GetInt(names.Fields.Tournaments.PlayerRestTime)
+}
+
+func (t *Tournament) QueueMode() string {
+	return t.GetString(names.Fields.Tournaments.QueueMode)
+}
+
+// MaxEntriesPerPlayer returns the number of competitions that a player can enter. 0 means unlimited.
+func (t *Tournament) MaxEntriesPerPlayer() int {
+	return t.GetInt(names.Fields.Tournaments.MaxEntriesPerPlayer)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"testing"
+
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Creates an unsaved team with the players
+func newTestTeam(id string, playerIds ...string) *Team {
+	collection := core.NewBaseCollection(names.Collections.Teams)
+	collection.Fields.Add(&core.RelationField{Name: names.Fields.Teams.Players, MaxSelect: 2})
+
+	record := core.NewRecord(collection)
+	record.Id = id
+	record.Set(names.Fields.Teams.Players, playerIds)
+
+	return WrapRecord[Team](record)
+}
+
+// Creates an unsaved competition with the registered and waitlisted teams expanded
+func newTestCompetition(maxEntries int, registrations []*Team, waitlist []*Team) *Competition {
+	collection := core.NewBaseCollection(names.Collections.Competitions)
+	collection.Fields.Add(
+		&core.NumberField{Name: names.Fields.Competitions.MaxEntries},
+		&core.RelationField{Name: names.Fields.Competitions.Registrations, MaxSelect: 999},
+		&core.RelationField{Name: names.Fields.Competitions.Waitlist, MaxSelect: 999},
+		&core.RelationField{Name: names.Fields.Competitions.Matches, MaxSelect: 999},
+	)
+
+	record := core.NewRecord(collection)
+	record.Set(names.Fields.Competitions.MaxEntries, maxEntries)
+
+	competition := WrapRecord[Competition](record)
+	competition.SetRegistrationIds(teamIds(registrations))
+	competition.SetWaitlistIds(teamIds(waitlist))
+
+	record.SetExpand(map[string]any{
+		names.Fields.Competitions.Registrations: teamRecords(registrations),
+		names.Fields.Competitions.Waitlist:      teamRecords(waitlist),
+	})
+
+	return competition
+}
+
+func teamIds(teams []*Team) []string {
+	ids := make([]string, 0, len(teams))
+	for _, team := range teams {
+		ids = append(ids, team.Id)
+	}
+	return ids
+}
+
+func teamRecords(teams []*Team) []*core.Record {
+	records := make([]*core.Record, 0, len(teams))
+	for _, team := range teams {
+		records = append(records, team.ProxyRecord())
+	}
+	return records
+}
+
+func TestCompetitionHasFreePlace(t *testing.T) {
+	teams := []*Team{newTestTeam("team1", "player1"), newTestTeam("team2", "player2")}
+
+	scenarios := []struct {
+		name       string
+		maxEntries int
+		teams      []*Team
+		expected   bool
+	}{
+		{"unlimited entries", 0, teams, true},
+		{"free place", 3, teams, true},
+		{"full", 2, teams, false},
+		{"over full", 1, teams, false},
+		{"empty", 1, nil, true},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			competition := newTestCompetition(s.maxEntries, s.teams, nil)
+
+			if result := competition.HasFreePlace(); result != s.expected {
+				t.Fatalf("expected %v, got %v", s.expected, result)
+			}
+		})
+	}
+}
+
+func TestCompetitionIsRunning(t *testing.T) {
+	competition := newTestCompetition(0, nil, nil)
+	if competition.IsRunning() {
+		t.Fatal("expected a competition without matches not to be running")
+	}
+
+	competition.Set(names.Fields.Competitions.Matches, []string{"match1"})
+	if !competition.IsRunning() {
+		t.Fatal("expected a competition with matches to be running")
+	}
+}
+
+func TestTeamSharesPlayerWith(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		team     *Team
+		other    *Team
+		expected bool
+	}{
+		{"same players", newTestTeam("a", "p1", "p2"), newTestTeam("b", "p1", "p2"), true},
+		{"one shared player", newTestTeam("a", "p1", "p2"), newTestTeam("b", "p3", "p2"), true},
+		{"single player team", newTestTeam("a", "p1"), newTestTeam("b", "p2", "p1"), true},
+		{"no shared player", newTestTeam("a", "p1", "p2"), newTestTeam("b", "p3", "p4"), false},
+		{"empty team", newTestTeam("a"), newTestTeam("b", "p1"), false},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if result := s.team.SharesPlayerWith(s.other); result != s.expected {
+				t.Fatalf("expected %v, got %v", s.expected, result)
+			}
+			if result := s.other.SharesPlayerWith(s.team); result != s.expected {
+				t.Fatalf("expected the reverse check to be %v, got %v", s.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,676 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+// One line of an import report. The row is the spreadsheet row (starting at 1 with the header).
+type ImportReportEntry struct {
+	Row         int
+	Description string
+}
+
+type ImportReport struct {
+	DryRun bool
+
+	CreatedClubs   []ImportReportEntry
+	CreatedPlayers []ImportReportEntry
+	MatchedPlayers []ImportReportEntry
+	CreatedTeams   []ImportReportEntry
+	MatchedTeams   []ImportReportEntry
+
+	// Rows that could not be imported. When only the competition entry of a row
+	// is rejected, its player is still imported.
+	RejectedRows []ImportReportEntry
+}
+
+// A spreadsheet row of the import. Each row holds a player and optionally one
+// competition entry of the player.
+type importRow struct {
+	Row int
+
+	FirstName   string
+	LastName    string
+	Club        string
+	Status      string
+	Notes       string
+	DateOfBirth string
+
+	// The competition is given by its discipline and categories e.g. "MD U15" or "WS A"
+	Competition      string
+	PartnerFirstName string
+	PartnerLastName  string
+}
+
+var errDryRun = errors.New("dry run")
+
+// PostPlayerImport handles POST requests to the /api/ezbadminton/players/import route.
+// It imports the players and competition entries from the uploaded "file" (CSV or XLSX).
+// With the "dryRun" query parameter set to true nothing is written and only the report is returned.
+func PostPlayerImport(e *core.RequestEvent, dao core.App) error {
+	dryRun := e.Request.URL.Query().Get("dryRun") == "true"
+
+	files, err := e.FindUploadedFiles("file")
+	if err != nil || len(files) != 1 {
+		return RespondError(e, missingFieldError("file"))
+	}
+
+	reader, err := files[0].Reader.Open()
+	if err != nil {
+		return RespondError(e, invalidSpreadsheetError("the file could not be opened"))
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return RespondError(e, invalidSpreadsheetError("the file could not be read"))
+	}
+
+	table, err := ReadSpreadsheet(files[0].OriginalName, data)
+	if err != nil {
+		return RespondError(e, invalidSpreadsheetError(err.Error()))
+	}
+
+	report, err := ImportPlayers(table, dryRun, dao)
+	if err != nil {
+		return RespondError(e, err)
+	}
+
+	return e.JSON(http.StatusOK, report)
+}
+
+// NewImportCommand creates the "import" command that imports the players and
+// competition entries of a CSV or XLSX file.
+func NewImportCommand(app *pocketbase.PocketBase) *cobra.Command {
+	var dryRun bool
+
+	command := &cobra.Command{
+		Use:          "import [file]",
+		Example:      "import registrations.xlsx --dry-run",
+		Short:        "Imports players and their competition entries from a CSV or XLSX file",
+		SilenceUsage: true,
+		RunE: func(command *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("missing file argument")
+			}
+
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return err
+			}
+
+			table, err := ReadSpreadsheet(args[0], data)
+			if err != nil {
+				return err
+			}
+
+			if err := app.RunAllMigrations(); err != nil {
+				return err
+			}
+
+			// The imported teams and registrations go through the same relation hooks as on the server
+			if err := RegisterRelationHooks(app); err != nil {
+				return err
+			}
+
+			report, err := ImportPlayers(table, dryRun, app)
+			if err != nil {
+				return err
+			}
+
+			printImportReport(report)
+
+			return nil
+		},
+	}
+
+	command.Flags().BoolVar(&dryRun, "dry-run", false, "only report what would be imported without changing the database")
+
+	return command
+}
+
+func printImportReport(report *ImportReport) {
+	if report.DryRun {
+		fmt.Println("Dry run. Nothing has been imported.")
+	}
+
+	for _, section := range []struct {
+		title   string
+		entries []ImportReportEntry
+	}{
+		{"Created clubs", report.CreatedClubs},
+		{"Created players", report.CreatedPlayers},
+		{"Matched existing players", report.MatchedPlayers},
+		{"Created teams", report.CreatedTeams},
+		{"Matched existing teams", report.MatchedTeams},
+		{"Rejected rows", report.RejectedRows},
+	} {
+		fmt.Printf("%s (%d):\n", section.title, len(section.entries))
+		for _, entry := range section.entries {
+			fmt.Printf("  row %d: %s\n", entry.Row, entry.Description)
+		}
+	}
+}
+
+// ImportPlayers creates the clubs, players and teams of the spreadsheet table in one transaction.
+// The first row of the table is the header. Records that already exist are matched by name
+// and reused. When dryRun is true, the transaction is rolled back after creating the report.
+func ImportPlayers(table []SpreadsheetRow, dryRun bool, dao core.App) (*ImportReport, error) {
+	rows, err := parseImportRows(table)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{
+		DryRun:         dryRun,
+		CreatedClubs:   []ImportReportEntry{},
+		CreatedPlayers: []ImportReportEntry{},
+		MatchedPlayers: []ImportReportEntry{},
+		CreatedTeams:   []ImportReportEntry{},
+		MatchedTeams:   []ImportReportEntry{},
+		RejectedRows:   []ImportReportEntry{},
+	}
+
+	transactionError := dao.RunInTransaction(func(txDao core.App) error {
+		importer, err := newPlayerImporter(report, txDao)
+		if err != nil {
+			return err
+		}
+
+		importedPlayers := make(map[int]*core.Record, len(rows))
+
+		for _, row := range rows {
+			player, err := importer.importPlayer(row)
+			if err != nil {
+				report.RejectedRows = append(report.RejectedRows, ImportReportEntry{row.Row, err.Error()})
+				continue
+			}
+			importedPlayers[row.Row] = player
+		}
+
+		// The entries are imported after all players exist so that partners can be found
+		for _, row := range rows {
+			player, imported := importedPlayers[row.Row]
+			if !imported || row.Competition == "" {
+				continue
+			}
+
+			if err := importer.importEntry(row, player); err != nil {
+				report.RejectedRows = append(report.RejectedRows, ImportReportEntry{row.Row, err.Error()})
+			}
+		}
+
+		if dryRun {
+			return errDryRun
+		}
+
+		return nil
+	})
+
+	if transactionError != nil && !errors.Is(transactionError, errDryRun) {
+		return nil, transactionError
+	}
+
+	return report, nil
+}
+
+// Maps the header names that are accepted in the import spreadsheet to the importRow fields
+var importColumns = map[string]func(row *importRow) *string{
+	"firstname":        func(row *importRow) *string { return &row.FirstName },
+	"lastname":         func(row *importRow) *string { return &row.LastName },
+	"club":             func(row *importRow) *string { return &row.Club },
+	"status":           func(row *importRow) *string { return &row.Status },
+	"notes":            func(row *importRow) *string { return &row.Notes },
+	"dateofbirth":      func(row *importRow) *string { return &row.DateOfBirth },
+	"birthdate":        func(row *importRow) *string { return &row.DateOfBirth },
+	"competition":      func(row *importRow) *string { return &row.Competition },
+	"partnerfirstname": func(row *importRow) *string { return &row.PartnerFirstName },
+	"partnerlastname":  func(row *importRow) *string { return &row.PartnerLastName },
+}
+
+// Parses the rows of the table according to its header row. Full names in a "name" or
+// "partner" column are split into first and last name at the last space.
+func parseImportRows(table []SpreadsheetRow) ([]importRow, error) {
+	if len(table) == 0 {
+		return nil, invalidSpreadsheetError("the spreadsheet is empty")
+	}
+
+	header := make([]string, len(table[0].Cells))
+	for i, title := range table[0].Cells {
+		header[i] = strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(strings.TrimSpace(title)))
+	}
+
+	if !slices.Contains(header, "name") && (!slices.Contains(header, "firstname") || !slices.Contains(header, "lastname")) {
+		return nil, invalidSpreadsheetError("the spreadsheet needs a name column or first and last name columns")
+	}
+
+	rows := make([]importRow, 0, len(table)-1)
+
+	for _, tableRow := range table[1:] {
+		row := importRow{Row: tableRow.Number}
+		empty := true
+
+		for column, value := range tableRow.Cells {
+			if column >= len(header) {
+				break
+			}
+			value = strings.TrimSpace(value)
+			if value != "" {
+				empty = false
+			}
+
+			switch header[column] {
+			case "name":
+				row.FirstName, row.LastName = splitFullName(value)
+			case "partner":
+				row.PartnerFirstName, row.PartnerLastName = splitFullName(value)
+			default:
+				if field, exists := importColumns[header[column]]; exists {
+					*field(&row) = value
+				}
+			}
+		}
+
+		if !empty {
+			rows = append(rows, row)
+		}
+	}
+
+	return rows, nil
+}
+
+func splitFullName(fullName string) (string, string) {
+	separator := strings.LastIndex(fullName, " ")
+	if separator == -1 {
+		return "", fullName
+	}
+	return strings.TrimSpace(fullName[:separator]), strings.TrimSpace(fullName[separator+1:])
+}
+
+// Holds the existing records of the import transaction to match the rows against
+type playerImporter struct {
+	report *ImportReport
+	dao    core.App
+
+	clubCollection   *core.Collection
+	playerCollection *core.Collection
+	teamCollection   *core.Collection
+
+	clubsByName   map[string]*core.Record
+	playersByName map[string][]*core.Record
+	competitions  []*core.Record
+	ageGroups     []*core.Record
+	playingLevels []*core.Record
+
+	// The teams that have been imported mapped by competition and player ids
+	importedTeams map[string]struct{}
+}
+
+func newPlayerImporter(report *ImportReport, dao core.App) (*playerImporter, error) {
+	importer := &playerImporter{
+		report:        report,
+		dao:           dao,
+		clubsByName:   map[string]*core.Record{},
+		playersByName: map[string][]*core.Record{},
+		importedTeams: map[string]struct{}{},
+	}
+
+	var err error
+	if importer.clubCollection, err = dao.FindCollectionByNameOrId(names.Collections.Clubs); err != nil {
+		return nil, err
+	}
+	if importer.playerCollection, err = dao.FindCollectionByNameOrId(names.Collections.Players); err != nil {
+		return nil, err
+	}
+	if importer.teamCollection, err = dao.FindCollectionByNameOrId(names.Collections.Teams); err != nil {
+		return nil, err
+	}
+
+	clubs, err := FetchCollection(names.Collections.Clubs, dao)
+	if err != nil {
+		return nil, err
+	}
+	for _, club := range clubs {
+		importer.clubsByName[normalizeName(club.GetString(names.Fields.Clubs.Name))] = club
+	}
+
+	players, err := FetchCollection(names.Collections.Players, dao)
+	if err != nil {
+		return nil, err
+	}
+	for _, player := range players {
+		importer.addPlayer(player)
+	}
+
+	if importer.competitions, err = FetchCollection(names.Collections.Competitions, dao); err != nil {
+		return nil, err
+	}
+	if importer.ageGroups, err = FetchCollection(names.Collections.AgeGroups, dao); err != nil {
+		return nil, err
+	}
+	if importer.playingLevels, err = FetchCollection(names.Collections.PlayingLevels, dao); err != nil {
+		return nil, err
+	}
+
+	return importer, nil
+}
+
+func (importer *playerImporter) addPlayer(player *core.Record) {
+	name := normalizeName(player.GetString(names.Fields.Players.FirstName) + " " + player.GetString(names.Fields.Players.LastName))
+	importer.playersByName[name] = append(importer.playersByName[name], player)
+}
+
+// Finds or creates the player of the row and its club
+func (importer *playerImporter) importPlayer(row importRow) (*core.Record, error) {
+	if row.FirstName == "" || row.LastName == "" {
+		return nil, errors.New("the player needs a first and a last name")
+	}
+
+	status := row.Status
+	if status == "" {
+		status = "notAttending"
+	}
+	statusField := importer.playerCollection.Fields.GetByName(names.Fields.Players.Status).(*core.SelectField)
+	if !slices.Contains(statusField.Values, status) {
+		return nil, fmt.Errorf("%q is not a valid player status", row.Status)
+	}
+
+	var dateOfBirth any
+	if row.DateOfBirth != "" {
+		date, err := ParseSpreadsheetDate(row.DateOfBirth)
+		if err != nil {
+			return nil, err
+		}
+		dateOfBirth = date
+	}
+
+	clubId := ""
+	if row.Club != "" {
+		club, err := importer.findOrCreateClub(row)
+		if err != nil {
+			return nil, err
+		}
+		clubId = club.Id
+	}
+
+	fullName := row.FirstName + " " + row.LastName
+
+	for _, player := range importer.playersByName[normalizeName(fullName)] {
+		if player.GetString(names.Fields.Players.Club) == clubId {
+			importer.report.MatchedPlayers = append(importer.report.MatchedPlayers, ImportReportEntry{row.Row, fullName})
+			return player, nil
+		}
+	}
+
+	player := core.NewRecord(importer.playerCollection)
+	player.Set(names.Fields.Players.FirstName, row.FirstName)
+	player.Set(names.Fields.Players.LastName, row.LastName)
+	player.Set(names.Fields.Players.Club, clubId)
+	player.Set(names.Fields.Players.Status, status)
+	player.Set(names.Fields.Players.Notes, row.Notes)
+	player.Set(names.Fields.Players.DateOfBirth, dateOfBirth)
+
+	if err := importer.dao.Save(player); err != nil {
+		return nil, err
+	}
+
+	importer.addPlayer(player)
+	importer.report.CreatedPlayers = append(importer.report.CreatedPlayers, ImportReportEntry{row.Row, fullName})
+
+	return player, nil
+}
+
+func (importer *playerImporter) findOrCreateClub(row importRow) (*core.Record, error) {
+	if club, exists := importer.clubsByName[normalizeName(row.Club)]; exists {
+		return club, nil
+	}
+
+	club := core.NewRecord(importer.clubCollection)
+	club.Set(names.Fields.Clubs.Name, row.Club)
+
+	if err := importer.dao.Save(club); err != nil {
+		return nil, err
+	}
+
+	importer.clubsByName[normalizeName(row.Club)] = club
+	importer.report.CreatedClubs = append(importer.report.CreatedClubs, ImportReportEntry{row.Row, row.Club})
+
+	return club, nil
+}
+
+// Registers the player of the row (and the partner) for the competition of the row
+func (importer *playerImporter) importEntry(row importRow, player *core.Record) error {
+	competition, err := importer.findCompetition(row.Competition)
+	if err != nil {
+		return err
+	}
+	// Earlier rows might have changed the registrations
+	competition, err = importer.dao.FindRecordById(names.Collections.Competitions, competition.Id)
+	if err != nil {
+		return err
+	}
+
+	teamPlayers := []*core.Record{player}
+
+	hasPartner := row.PartnerFirstName != "" || row.PartnerLastName != ""
+	teamSize := competition.GetInt(names.Fields.Competitions.TeamSize)
+
+	if hasPartner && teamSize == 1 {
+		return fmt.Errorf("%q is a singles competition but a partner is given", row.Competition)
+	}
+
+	if hasPartner {
+		partner, err := importer.findPartner(row, player)
+		if err != nil {
+			return err
+		}
+		teamPlayers = append(teamPlayers, partner)
+	}
+
+	teamPlayerIds := make([]string, 0, len(teamPlayers))
+	teamNames := make([]string, 0, len(teamPlayers))
+	for _, teamPlayer := range teamPlayers {
+		teamPlayerIds = append(teamPlayerIds, teamPlayer.Id)
+		teamNames = append(teamNames, teamPlayer.GetString(names.Fields.Players.FirstName)+" "+teamPlayer.GetString(names.Fields.Players.LastName))
+	}
+	slices.Sort(teamPlayerIds)
+
+	description := fmt.Sprintf("%s: %s", row.Competition, strings.Join(teamNames, " & "))
+
+	// Both partners of a team can have a row with the entry
+	teamKey := competition.Id + strings.Join(teamPlayerIds, "")
+	if _, imported := importer.importedTeams[teamKey]; imported {
+		return nil
+	}
+	importer.importedTeams[teamKey] = struct{}{}
+
+	enteredFields := []string{names.Fields.Competitions.Registrations, names.Fields.Competitions.Waitlist}
+	if err := importer.dao.ExpandRecord(competition, enteredFields, nil); len(err) != 0 {
+		return errors.New("could not expand the teams of the competition")
+	}
+	enteredTeams := append(
+		competition.ExpandedAll(names.Fields.Competitions.Registrations),
+		competition.ExpandedAll(names.Fields.Competitions.Waitlist)...,
+	)
+
+	for _, team := range enteredTeams {
+		registeredPlayerIds := team.GetStringSlice(names.Fields.Teams.Players)
+		slices.Sort(registeredPlayerIds)
+
+		if slices.Equal(registeredPlayerIds, teamPlayerIds) {
+			importer.report.MatchedTeams = append(importer.report.MatchedTeams, ImportReportEntry{row.Row, description})
+			return nil
+		}
+	}
+
+	team := core.NewRecord(importer.teamCollection)
+	team.Set(names.Fields.Teams.Players, teamPlayerIds)
+
+	// The import does not replace the existing team of a player like the registration of a new team does
+	if len(findDoubleRegisteredTeams(enteredTeams, team)) != 0 {
+		return fmt.Errorf("a player of the team is already entered for %q in another team", row.Competition)
+	}
+
+	if err := validatePlayerEntries(team, competition, importer.dao); err != nil {
+		return err
+	}
+
+	if err := importer.dao.Save(team); err != nil {
+		return err
+	}
+
+	// The team is only kept when it can be registered so that a rejected row leaves no team behind
+	if err := HandleCreatedTeam(team, competition.Id, importer.dao); err != nil {
+		return errors.Join(err, importer.dao.Delete(team))
+	}
+
+	importer.report.CreatedTeams = append(importer.report.CreatedTeams, ImportReportEntry{row.Row, description})
+
+	return nil
+}
+
+// Finds the partner of the row's player. Partners from the player's club are preferred.
+func (importer *playerImporter) findPartner(row importRow, player *core.Record) (*core.Record, error) {
+	partnerName := row.PartnerFirstName + " " + row.PartnerLastName
+	candidates := importer.playersByName[normalizeName(partnerName)]
+
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("the partner %q is not a player", partnerName)
+	}
+
+	for _, candidate := range candidates {
+		if candidate.GetString(names.Fields.Players.Club) == player.GetString(names.Fields.Players.Club) {
+			return candidate, nil
+		}
+	}
+
+	if len(candidates) > 1 {
+		return nil, fmt.Errorf("the partner %q is ambiguous", partnerName)
+	}
+
+	return candidates[0], nil
+}
+
+// Abbreviations of the disciplines that can be used to name a competition in the import.
+// The english and the german abbreviations are supported.
+var disciplineAbbreviations = map[string]struct {
+	GenderCategory string
+	TeamSize       int
+}{
+	"MS": {"male", 1}, "HE": {"male", 1},
+	"WS": {"female", 1}, "DE": {"female", 1},
+	"MD": {"male", 2}, "HD": {"male", 2},
+	"WD": {"female", 2}, "DD": {"female", 2},
+	"XD": {"mixed", 2}, "MX": {"mixed", 2}, "GD": {"mixed", 2},
+	"S": {"any", 1}, "D": {"any", 2},
+}
+
+// Finds the competition that is described by the discipline abbreviation and the
+// category names e.g. "MD U15" or "WS O35 A". Age groups are named by their type
+// ("U" for under, "O" for over) and age. Playing levels are named by their name.
+func (importer *playerImporter) findCompetition(label string) (*core.Record, error) {
+	tokens := strings.Fields(label)
+	if len(tokens) == 0 {
+		return nil, errors.New("the competition is empty")
+	}
+
+	discipline, exists := disciplineAbbreviations[strings.ToUpper(tokens[0])]
+	if !exists {
+		return nil, fmt.Errorf("%q is not a known discipline", tokens[0])
+	}
+
+	ageGroupId := ""
+	playingLevelId := ""
+
+	for _, token := range tokens[1:] {
+		if ageGroup := findAgeGroupByName(importer.ageGroups, token); ageGroup != nil {
+			ageGroupId = ageGroup.Id
+			continue
+		}
+		if playingLevel := findPlayingLevelByName(importer.playingLevels, token); playingLevel != nil {
+			playingLevelId = playingLevel.Id
+			continue
+		}
+		return nil, fmt.Errorf("%q is not a known age group or playing level", token)
+	}
+
+	for _, competition := range importer.competitions {
+		if competition.GetString(names.Fields.Competitions.GenderCategory) == discipline.GenderCategory &&
+			competition.GetInt(names.Fields.Competitions.TeamSize) == discipline.TeamSize &&
+			competition.GetString(names.Fields.Competitions.AgeGroup) == ageGroupId &&
+			competition.GetString(names.Fields.Competitions.PlayingLevel) == playingLevelId {
+			return competition, nil
+		}
+	}
+
+	return nil, fmt.Errorf("there is no competition %q", label)
+}
+
+// Returns the age group that is named like "U15" or "O35" or nil if none matches
+func findAgeGroupByName(ageGroups []*core.Record, name string) *core.Record {
+	ageGroupType, age, valid := parseAgeGroupName(name)
+	if !valid {
+		return nil
+	}
+
+	for _, ageGroup := range ageGroups {
+		if ageGroup.GetString(names.Fields.AgeGroups.Type) == ageGroupType && ageGroup.GetInt(names.Fields.AgeGroups.Age) == age {
+			return ageGroup
+		}
+	}
+
+	return nil
+}
+
+// Returns the type ("under" or "over") and the age of an age group name like "U15" or "O35"
+func parseAgeGroupName(name string) (string, int, bool) {
+	if len(name) < 2 {
+		return "", 0, false
+	}
+
+	var ageGroupType string
+	switch strings.ToUpper(name[:1]) {
+	case "U":
+		ageGroupType = "under"
+	case "O":
+		ageGroupType = "over"
+	default:
+		return "", 0, false
+	}
+
+	age, err := strconv.Atoi(name[1:])
+	if err != nil {
+		return "", 0, false
+	}
+
+	return ageGroupType, age, true
+}
+
+func findPlayingLevelByName(playingLevels []*core.Record, name string) *core.Record {
+	for _, playingLevel := range playingLevels {
+		if normalizeName(playingLevel.GetString(names.Fields.PlayingLevels.Name)) == normalizeName(name) {
+			return playingLevel
+		}
+	}
+
+	return nil
+}
+
+// Returns an INVALID_SPREADSHEET error about the uploaded file
+func invalidSpreadsheetError(message string) *ApiError {
+	return NewApiError(http.StatusBadRequest, ErrorCodeInvalidSpreadsheet, "the spreadsheet cannot be imported").
+		WithDetail("file", FieldErrorCodeInvalid, message)
+}
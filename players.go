@@ -0,0 +1,318 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// A pair of players that are likely the same person
+type DuplicatePlayers struct {
+	Player    string
+	Duplicate string
+
+	// The summed edit distance of the first and last names
+	Distance int
+}
+
+// GetDuplicatePlayers handles GET requests to the /api/ezbadminton/players/duplicates route.
+// It responds with the pairs of players that have similar names and are in the same club.
+func GetDuplicatePlayers(e *core.RequestEvent, dao core.App) error {
+	players, err := FetchCollection(names.Collections.Players, dao)
+	if err != nil {
+		return RespondError(e, err)
+	}
+
+	return e.JSON(http.StatusOK, FindDuplicatePlayers(players))
+}
+
+// PostPlayerMerge handles POST requests to the /api/ezbadminton/players/merge route.
+// It merges the "duplicate" player into the "player" from the request body.
+func PostPlayerMerge(e *core.RequestEvent, dao core.App) error {
+	body := struct {
+		Player    string
+		Duplicate string
+	}{}
+
+	if err := e.BindBody(&body); err != nil {
+		return RespondError(e, invalidBodyError())
+	}
+	if body.Player == "" {
+		return RespondError(e, missingFieldError("player"))
+	}
+	if body.Duplicate == "" {
+		return RespondError(e, missingFieldError("duplicate"))
+	}
+
+	if err := MergePlayers(body.Player, body.Duplicate, dao); err != nil {
+		return RespondError(e, err)
+	}
+
+	return e.NoContent(http.StatusOK)
+}
+
+// FindDuplicatePlayers returns the pairs of players that are in the same club and whose names
+// are within a small edit distance of each other. Swapped first and last names are also detected.
+// The pairs are ordered by their distance.
+func FindDuplicatePlayers(players []*core.Record) []DuplicatePlayers {
+	duplicates := []DuplicatePlayers{}
+
+	for i := 0; i < len(players); i += 1 {
+		for j := i + 1; j < len(players); j += 1 {
+			player := players[i]
+			other := players[j]
+
+			if player.GetString(names.Fields.Players.Club) != other.GetString(names.Fields.Players.Club) {
+				continue
+			}
+
+			if distance, similar := comparePlayerNames(player, other); similar {
+				duplicates = append(duplicates, DuplicatePlayers{
+					Player:    player.Id,
+					Duplicate: other.Id,
+					Distance:  distance,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(duplicates, func(a, b int) bool {
+		return duplicates[a].Distance < duplicates[b].Distance
+	})
+
+	return duplicates
+}
+
+// MergePlayers replaces the duplicate player with the surviving player in all of its teams
+// and deletes the duplicate afterwards. When this causes the surviving player to be
+// registered twice for a competition, the survivor's own team is kept.
+// The merge is rejected when the entries of the merged player would exceed the tournament's
+// limit of entries per player or include two competitions of the same discipline.
+// Empty fields of the surviving player are filled with the values of the duplicate.
+func MergePlayers(playerId string, duplicateId string, dao core.App) error {
+	if playerId == duplicateId {
+		return rejectedError(ErrorCodePlayerMergedWithItself, "cannot merge a player with itself").
+			WithDetail("duplicate", FieldErrorCodeInvalid, "the duplicate has to be another player")
+	}
+
+	return dao.RunInTransaction(func(txDao core.App) error {
+		player, err := FetchRecord(names.Collections.Players, playerId, txDao)
+		if err != nil {
+			return err
+		}
+		duplicate, err := FetchRecord(names.Collections.Players, duplicateId, txDao)
+		if err != nil {
+			return err
+		}
+
+		teamsOfPlayer, err := FindReverseMultiRelations(player.Id, names.Collections.Teams, names.Fields.Teams.Players, txDao)
+		if err != nil {
+			return err
+		}
+		teamsOfDuplicate, err := FindReverseMultiRelations(duplicate.Id, names.Collections.Teams, names.Fields.Teams.Players, txDao)
+		if err != nil {
+			return err
+		}
+
+		for _, team := range teamsOfDuplicate {
+			team.Set(names.Fields.Teams.Players, replaceTeamMember(
+				team.GetStringSlice(names.Fields.Teams.Players),
+				duplicate.Id,
+				player.Id,
+			))
+
+			if err := txDao.Save(team); err != nil {
+				return err
+			}
+		}
+
+		for _, team := range teamsOfPlayer {
+			competition, err := findCompetitionOfTeam(team.Id, txDao)
+			if err != nil {
+				return err
+			}
+			if competition == nil {
+				continue
+			}
+
+			if err := deleteDoubleRegistrations(team, competition, txDao); err != nil {
+				return err
+			}
+		}
+
+		mergedTeams, err := FindReverseMultiRelations(player.Id, names.Collections.Teams, names.Fields.Teams.Players, txDao)
+		if err != nil {
+			return err
+		}
+
+		for _, team := range mergedTeams {
+			competition, err := findCompetitionOfTeam(team.Id, txDao)
+			if err != nil {
+				return err
+			}
+			if competition == nil {
+				continue
+			}
+
+			if err := validatePlayerEntries(team, competition, txDao); err != nil {
+				return err
+			}
+		}
+
+		for _, fieldName := range []string{
+			names.Fields.Players.Club,
+			names.Fields.Players.Notes,
+			names.Fields.Players.Gender,
+			names.Fields.Players.PlayingLevel,
+		} {
+			if player.GetString(fieldName) == "" {
+				player.Set(fieldName, duplicate.Get(fieldName))
+			}
+		}
+
+		if err := txDao.Save(player); err != nil {
+			return err
+		}
+
+		if err := txDao.Delete(duplicate); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// Returns the team member ids with the replaced member exchanged for the replacement.
+// The replacement is not added twice if it is already a member.
+func replaceTeamMember(memberIds []string, replacedId string, replacementId string) []string {
+	updatedMemberIds := make([]string, 0, len(memberIds))
+
+	for _, memberId := range memberIds {
+		if memberId == replacedId {
+			memberId = replacementId
+		}
+
+		alreadyMember := false
+		for _, updatedMemberId := range updatedMemberIds {
+			if updatedMemberId == memberId {
+				alreadyMember = true
+				break
+			}
+		}
+
+		if !alreadyMember {
+			updatedMemberIds = append(updatedMemberIds, memberId)
+		}
+	}
+
+	return updatedMemberIds
+}
+
+// Compares the names of the two players and returns the edit distance and
+// wether they are similar enough to be the same person
+func comparePlayerNames(player *core.Record, other *core.Record) (int, bool) {
+	firstName := normalizeName(player.GetString(names.Fields.Players.FirstName))
+	lastName := normalizeName(player.GetString(names.Fields.Players.LastName))
+	otherFirstName := normalizeName(other.GetString(names.Fields.Players.FirstName))
+	otherLastName := normalizeName(other.GetString(names.Fields.Players.LastName))
+
+	if firstName == "" && lastName == "" {
+		return 0, false
+	}
+
+	distance := 0
+	similar := false
+
+	for _, comparison := range [][4]string{
+		{firstName, otherFirstName, lastName, otherLastName},
+		// Detect swapped first and last names
+		{firstName, otherLastName, lastName, otherFirstName},
+	} {
+		firstDistance := levenshteinDistance(comparison[0], comparison[1])
+		lastDistance := levenshteinDistance(comparison[2], comparison[3])
+
+		if firstDistance <= allowedNameDistance(comparison[0], comparison[1]) &&
+			lastDistance <= allowedNameDistance(comparison[2], comparison[3]) {
+			if !similar || firstDistance+lastDistance < distance {
+				distance = firstDistance + lastDistance
+			}
+			similar = true
+		}
+	}
+
+	return distance, similar
+}
+
+// Returns how many edits two names can be apart while still being considered the same.
+// Short names have to match more closely.
+func allowedNameDistance(name string, other string) int {
+	length := min(len([]rune(name)), len([]rune(other)))
+
+	switch {
+	case length <= 3:
+		return 0
+	case length <= 6:
+		return 1
+	default:
+		return 2
+	}
+}
+
+var nameReplacer = strings.NewReplacer(
+	"ä", "ae",
+	"ö", "oe",
+	"ü", "ue",
+	"ß", "ss",
+	"é", "e",
+	"è", "e",
+	"á", "a",
+	"à", "a",
+	"-", " ",
+	".", "",
+)
+
+// Returns the name in lower case with umlauts and accents replaced by their plain
+// spelling and without surrounding or repeated whitespace
+func normalizeName(name string) string {
+	name = nameReplacer.Replace(strings.ToLower(name))
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// Returns the minimum number of single character insertions, deletions or substitutions
+// that are needed to turn a into b
+func levenshteinDistance(a string, b string) int {
+	runesA := []rune(a)
+	runesB := []rune(b)
+
+	previousRow := make([]int, len(runesB)+1)
+	currentRow := make([]int, len(runesB)+1)
+
+	for j := range previousRow {
+		previousRow[j] = j
+	}
+
+	for i := 1; i <= len(runesA); i += 1 {
+		currentRow[0] = i
+
+		for j := 1; j <= len(runesB); j += 1 {
+			substitutionCost := 1
+			if runesA[i-1] == runesB[j-1] {
+				substitutionCost = 0
+			}
+
+			currentRow[j] = min(
+				previousRow[j]+1,
+				currentRow[j-1]+1,
+				previousRow[j-1]+substitutionCost,
+			)
+		}
+
+		previousRow, currentRow = currentRow, previousRow
+	}
+
+	return previousRow[len(runesB)]
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/subscriptions"
+)
+
+// The realtime topic that the relation changes are published on. Clients subscribe to it
+// like to a collection topic.
+const RelationChangesTopic = "ezbadminton/changes"
+
+// A record that changed because a record in one of its relations has been updated
+type RelationChange struct {
+	Collection string
+	Record     string
+
+	// The relation field of the record that holds the updated record
+	Field string
+
+	ChildCollection string
+	Child           string
+}
+
+// The message of the RelationChangesTopic
+type RelationChangesMessage struct {
+	Changes []RelationChange
+}
+
+// A relation field whose updated records are cascaded to the records that hold them
+type relationCascade struct {
+	collectionName string
+	fieldName      string
+	findRelations  func(string, string, string, core.App) ([]*core.Record, error)
+}
+
+// The registered cascades mapped by the name of the collection that the relation field points to
+var relationCascades = map[string][]relationCascade{}
+
+// The relation changes that a transaction publishes once it has been committed
+type cascadeBatch struct {
+	changes    []RelationChange
+	changeKeys map[RelationChange]struct{}
+
+	// The updated records that caused the changes
+	causes []*core.Record
+}
+
+// The pending cascade batches. A batch is collected per transaction and published when the
+// first of its causing records has been successfully saved which happens after the commit.
+// Saves outside of a transaction collect a batch of their own per causing record.
+var cascadeBatches = struct {
+	sync.Mutex
+
+	byApp   map[core.App]*cascadeBatch
+	byCause map[*core.Record]*cascadeBatch
+}{
+	byApp:   map[core.App]*cascadeBatch{},
+	byCause: map[*core.Record]*cascadeBatch{},
+}
+
+// RegisterCascadeBatchFlush registers the hooks that publish the cascade batches of committed
+// transactions and discard the ones of failed transactions.
+func RegisterCascadeBatchFlush(app *pocketbase.PocketBase) {
+	app.OnRecordAfterUpdateSuccess().BindFunc(func(e *core.RecordEvent) error {
+		if err := e.Next(); err != nil {
+			return err
+		}
+
+		// The cascades are only notifications of the clients. A failed flush does not
+		// fail the update that caused it.
+		if err := flushCascadeBatch(e.Record, e.App); err != nil {
+			e.App.Logger().Error("relation update cascade failed", "record", e.Record.Id, "error", err)
+		}
+
+		return nil
+	})
+
+	app.OnRecordAfterUpdateError().BindFunc(func(e *core.RecordErrorEvent) error {
+		takeCascadeBatch(e.Record)
+		return e.Next()
+	})
+}
+
+// Adds the changes of the records that hold the updated record in their relation field
+// to the cascade batch of the app's transaction. Without a transaction the changes are added
+// to the batch of the updated record.
+func addToCascadeBatch(
+	cause *core.Record,
+	relatedRecords []*core.Record,
+	fieldName string,
+	dao core.App,
+) {
+	cascadeBatches.Lock()
+	defer cascadeBatches.Unlock()
+
+	batch, exists := cascadeBatches.byCause[cause]
+	if !exists && dao.IsTransactional() {
+		batch, exists = cascadeBatches.byApp[dao]
+	}
+	if !exists {
+		batch = &cascadeBatch{
+			changeKeys: map[RelationChange]struct{}{},
+		}
+		// The main app is shared by all requests. Only the app of a transaction
+		// can key the batch.
+		if dao.IsTransactional() {
+			cascadeBatches.byApp[dao] = batch
+		}
+	}
+
+	if _, isCause := cascadeBatches.byCause[cause]; !isCause {
+		batch.causes = append(batch.causes, cause)
+		cascadeBatches.byCause[cause] = batch
+	}
+
+	for _, record := range relatedRecords {
+		batch.add(RelationChange{
+			Collection:      record.Collection().Name,
+			Record:          record.Id,
+			Field:           fieldName,
+			ChildCollection: cause.Collection().Name,
+			Child:           cause.Id,
+		})
+	}
+}
+
+// Adds the change unless it is already in the batch. Returns wether it was added.
+func (batch *cascadeBatch) add(change RelationChange) bool {
+	if _, isAdded := batch.changeKeys[change]; isAdded {
+		return false
+	}
+	batch.changeKeys[change] = struct{}{}
+	batch.changes = append(batch.changes, change)
+	return true
+}
+
+// Removes and returns the batch that the record caused. Returns nil when there is none.
+func takeCascadeBatch(cause *core.Record) *cascadeBatch {
+	cascadeBatches.Lock()
+	defer cascadeBatches.Unlock()
+
+	batch, exists := cascadeBatches.byCause[cause]
+	if !exists {
+		return nil
+	}
+
+	for _, batchCause := range batch.causes {
+		delete(cascadeBatches.byCause, batchCause)
+	}
+	for app, appBatch := range cascadeBatches.byApp {
+		if appBatch == batch {
+			delete(cascadeBatches.byApp, app)
+		}
+	}
+
+	return batch
+}
+
+// Publishes the changes of the batch that the record caused together with the changes
+// that they cascade to in one message
+func flushCascadeBatch(cause *core.Record, dao core.App) error {
+	batch := takeCascadeBatch(cause)
+	if batch == nil {
+		return nil
+	}
+
+	if err := addTransitiveCascades(batch, dao); err != nil {
+		return err
+	}
+
+	return publishRelationChanges(batch.changes, dao)
+}
+
+// Adds the changes of the records that hold the changed records of the batch in their relations.
+// Each change is only added once.
+func addTransitiveCascades(batch *cascadeBatch, dao core.App) error {
+	// The changed records whose cascades have been added
+	cascadedRecords := map[string]struct{}{}
+
+	for i := 0; i < len(batch.changes); i += 1 {
+		change := batch.changes[i]
+
+		recordKey := change.Collection + "/" + change.Record
+		if _, isCascaded := cascadedRecords[recordKey]; isCascaded {
+			continue
+		}
+		cascadedRecords[recordKey] = struct{}{}
+
+		for _, cascade := range relationCascades[change.Collection] {
+			relations, err := cascade.findRelations(change.Record, cascade.collectionName, cascade.fieldName, dao)
+			if err != nil {
+				return err
+			}
+
+			for _, relation := range relations {
+				batch.add(RelationChange{
+					Collection:      relation.Collection().Name,
+					Record:          relation.Id,
+					Field:           cascade.fieldName,
+					ChildCollection: change.Collection,
+					Child:           change.Record,
+				})
+			}
+		}
+	}
+
+	return nil
+}
+
+// Sends the changes to the authenticated realtime clients that subscribed to the RelationChangesTopic
+func publishRelationChanges(changes []RelationChange, dao core.App) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(RelationChangesMessage{Changes: changes})
+	if err != nil {
+		return err
+	}
+
+	message := subscriptions.Message{
+		Name: RelationChangesTopic,
+		Data: data,
+	}
+
+	for _, client := range dao.SubscriptionsBroker().Clients() {
+		if !client.HasSubscription(RelationChangesTopic) {
+			continue
+		}
+		if auth, _ := client.Get(apis.RealtimeClientAuthKey).(*core.Record); auth == nil {
+			continue
+		}
+
+		client.Send(message)
+	}
+
+	return nil
+}
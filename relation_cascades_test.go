@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// An app that is only asked whether it is part of a transaction
+type testCascadeApp struct {
+	core.App
+	transactional bool
+}
+
+func (app *testCascadeApp) IsTransactional() bool {
+	return app.transactional
+}
+
+// Creates an unsaved record of a collection with the name
+func newTestCascadeRecord(collectionName string, id string) *core.Record {
+	record := core.NewRecord(core.NewBaseCollection(collectionName))
+	record.Id = id
+	return record
+}
+
+func TestCascadeBatchesWithoutTransaction(t *testing.T) {
+	app := &testCascadeApp{}
+	competition := newTestCascadeRecord("competitions", "competition1")
+
+	cause1 := newTestCascadeRecord("teams", "team1")
+	cause2 := newTestCascadeRecord("teams", "team2")
+
+	addToCascadeBatch(cause1, []*core.Record{competition}, "registrations", app)
+	addToCascadeBatch(cause2, []*core.Record{competition}, "registrations", app)
+
+	// A failed save of the first record discards only its own batch
+	if batch := takeCascadeBatch(cause1); batch == nil || len(batch.changes) != 1 || batch.changes[0].Child != "team1" {
+		t.Fatalf("expected the batch of team1 with its change, got %+v", batch)
+	}
+
+	batch := takeCascadeBatch(cause2)
+	if batch == nil || len(batch.changes) != 1 || batch.changes[0].Child != "team2" {
+		t.Fatalf("expected the batch of team2 with its change, got %+v", batch)
+	}
+}
+
+func TestCascadeBatchesOfTransaction(t *testing.T) {
+	txApp := &testCascadeApp{transactional: true}
+	otherTxApp := &testCascadeApp{transactional: true}
+	competition := newTestCascadeRecord("competitions", "competition1")
+
+	cause1 := newTestCascadeRecord("teams", "team1")
+	cause2 := newTestCascadeRecord("teams", "team2")
+	otherCause := newTestCascadeRecord("teams", "team3")
+
+	addToCascadeBatch(cause1, []*core.Record{competition}, "registrations", txApp)
+	addToCascadeBatch(cause2, []*core.Record{competition}, "registrations", txApp)
+	addToCascadeBatch(otherCause, []*core.Record{competition}, "registrations", otherTxApp)
+
+	batch := takeCascadeBatch(cause2)
+	if batch == nil || len(batch.changes) != 2 {
+		t.Fatalf("expected one batch with the changes of the transaction, got %+v", batch)
+	}
+	if takeCascadeBatch(cause1) != nil {
+		t.Fatal("expected the batch of the transaction to be taken with its first cause")
+	}
+
+	otherBatch := takeCascadeBatch(otherCause)
+	if otherBatch == nil || len(otherBatch.changes) != 1 || otherBatch.changes[0].Child != "team3" {
+		t.Fatalf("expected the batch of the other transaction to be kept, got %+v", otherBatch)
+	}
+}
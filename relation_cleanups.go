@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// The behaviour of a relation when the record that it points to is deleted
+type DeleteBehaviour string
+
+const (
+	// The records that hold the deleted record are deleted as well
+	DeleteCascade DeleteBehaviour = "cascade"
+	// The deletion is rejected as long as records hold the deleted record
+	DeleteRestrict DeleteBehaviour = "restrict"
+	// The deleted record is removed from the relation of the records that hold it
+	DeleteNullify DeleteBehaviour = "nullify"
+)
+
+// A relation field whose records are owned by the records that hold them
+type ownedRelation struct {
+	collectionName string
+	fieldName      string
+	findRelations  func(string, string, string, core.App) ([]*core.Record, error)
+}
+
+// The registered owned relations mapped by the name of the collection of the owned records
+var ownedRelations = map[string][]ownedRelation{}
+
+// RegisterRelationDeleteRule registers a hook that applies the delete behaviour to the models in
+// the collection that hold a deleted model under the field name.
+//
+// The behaviour is applied in the transaction of the deletion before the model is deleted.
+func RegisterRelationDeleteRule(
+	collectionName string,
+	fieldName string,
+	behaviour DeleteBehaviour,
+	app *pocketbase.PocketBase,
+) error {
+	relationField, relationGetter, err := findRelationField(collectionName, fieldName, app)
+	if err != nil {
+		return err
+	}
+
+	app.OnRecordDelete(relationField.CollectionId).BindFunc(func(e *core.RecordEvent) error {
+		return runRecordEventInTransaction(e, func(txApp core.App) error {
+			holders, err := relationGetter(e.Record.Id, collectionName, fieldName, txApp)
+			if err != nil {
+				return err
+			}
+
+			if len(holders) == 0 {
+				return nil
+			}
+
+			switch behaviour {
+			case DeleteCascade:
+				return ProcessAsModels(holders, txApp.Delete)
+			case DeleteRestrict:
+				return rejectedError(
+					ErrorCodeDeleteRestricted,
+					fmt.Sprintf("the record is still related to %d records of %s", len(holders), collectionName),
+				)
+			case DeleteNullify:
+				return ProcessAsRecords(holders, func(holder *core.Record) error {
+					holder.Set(fieldName, withoutIds(holder.GetStringSlice(fieldName), []string{e.Record.Id}))
+					return txApp.Save(holder)
+				})
+			}
+
+			return fmt.Errorf("unknown delete behaviour %q", behaviour)
+		}, nil)
+	})
+
+	return nil
+}
+
+// RegisterOwnedRelation registers the models that the models in the collection hold under the
+// field name as owned by them. The owned models are deleted together with their owner unless
+// another owner still holds them.
+//
+// With orphanRemoval the owned models are also deleted as soon as they have been removed
+// from the relation and no other owner holds them.
+func RegisterOwnedRelation(
+	collectionName string,
+	fieldName string,
+	orphanRemoval bool,
+	app *pocketbase.PocketBase,
+) error {
+	relationField, relationGetter, err := findRelationField(collectionName, fieldName, app)
+	if err != nil {
+		return err
+	}
+
+	ownedCollection, err := app.FindCollectionByNameOrId(relationField.CollectionId)
+	if err != nil {
+		return err
+	}
+
+	ownedRelations[ownedCollection.Name] = append(ownedRelations[ownedCollection.Name], ownedRelation{
+		collectionName: collectionName,
+		fieldName:      fieldName,
+		findRelations:  relationGetter,
+	})
+
+	app.OnRecordDelete(collectionName).BindFunc(func(e *core.RecordEvent) error {
+		return runRecordEventInTransaction(e, nil, func(txApp core.App) error {
+			return deleteOrphans(ownedCollection.Name, e.Record.GetStringSlice(fieldName), txApp)
+		})
+	})
+
+	if !orphanRemoval {
+		return nil
+	}
+
+	app.OnRecordUpdate(collectionName).BindFunc(func(e *core.RecordEvent) error {
+		// A restore puts back the relations of the owners one at a time
+		if isSnapshotRestore(e) {
+			return e.Next()
+		}
+
+		return runRecordEventInTransaction(e, nil, func(txApp core.App) error {
+			removedIds := withoutIds(e.Record.Original().GetStringSlice(fieldName), e.Record.GetStringSlice(fieldName))
+
+			return deleteOrphans(ownedCollection.Name, removedIds, txApp)
+		})
+	})
+
+	return nil
+}
+
+// RegisterEmptyRelationRemoval registers a hook that deletes the models in the collection
+// when an update leaves their relation under the field name empty.
+//
+// The model is deleted in the transaction of the update.
+func RegisterEmptyRelationRemoval(
+	collectionName string,
+	fieldName string,
+	app *pocketbase.PocketBase,
+) error {
+	if _, _, err := findRelationField(collectionName, fieldName, app); err != nil {
+		return err
+	}
+
+	app.OnRecordUpdate(collectionName).BindFunc(func(e *core.RecordEvent) error {
+		if isSnapshotRestore(e) {
+			return e.Next()
+		}
+
+		return runRecordEventInTransaction(e, nil, func(txApp core.App) error {
+			if len(e.Record.GetStringSlice(fieldName)) != 0 {
+				return nil
+			}
+
+			return txApp.Delete(e.Record)
+		})
+	})
+
+	return nil
+}
+
+// Deletes the records with the given IDs from the owned collection when none of
+// their owners holds them anymore
+func deleteOrphans(ownedCollectionName string, ids []string, dao core.App) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	ownedRecords, err := dao.FindRecordsByIds(ownedCollectionName, ids)
+	if err != nil {
+		return err
+	}
+
+	return ProcessAsRecords(ownedRecords, func(ownedRecord *core.Record) error {
+		for _, owned := range ownedRelations[ownedCollectionName] {
+			owners, err := owned.findRelations(ownedRecord.Id, owned.collectionName, owned.fieldName, dao)
+			if err != nil {
+				return err
+			}
+
+			if len(owners) != 0 {
+				return nil
+			}
+		}
+
+		return dao.Delete(ownedRecord)
+	})
+}
+
+// Returns a new slice of the IDs that are not in the excluded IDs
+func withoutIds(ids []string, excludedIds []string) []string {
+	remainingIds := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !slices.Contains(excludedIds, id) {
+			remainingIds = append(remainingIds, id)
+		}
+	}
+	return remainingIds
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// The multi-relation fields whose relations are kept in the relation index mapped by their collection
+var indexedRelations = map[string]map[string]struct{}{}
+
+// RegisterRelationIndex registers the hooks that keep the relations of the multi-relation
+// field in the relation index table. FindReverseMultiRelations uses the index for the
+// field instead of scanning the collection.
+//
+// The index rows of a record are written in the transaction of the record's save or deletion.
+// The existing relations have to be put into the index by a migration.
+func RegisterRelationIndex(collectionName string, fieldName string, app *pocketbase.PocketBase) {
+	if _, exists := indexedRelations[collectionName]; !exists {
+		indexedRelations[collectionName] = map[string]struct{}{}
+	}
+	indexedRelations[collectionName][fieldName] = struct{}{}
+
+	indexRecord := func(e *core.RecordEvent) error {
+		return runRecordEventInTransaction(e, nil, func(txApp core.App) error {
+			return writeRelationIndex(e.Record, fieldName, txApp)
+		})
+	}
+
+	app.OnRecordCreate(collectionName).BindFunc(indexRecord)
+	app.OnRecordUpdate(collectionName).BindFunc(indexRecord)
+
+	app.OnRecordDelete(collectionName).BindFunc(func(e *core.RecordEvent) error {
+		return runRecordEventInTransaction(e, nil, func(txApp core.App) error {
+			return deleteRelationIndex(collectionName, fieldName, e.Record.Id, txApp)
+		})
+	})
+}
+
+// Returns wether the relations of the field are in the relation index
+func isRelationIndexed(collectionName string, fieldName string) bool {
+	_, isIndexed := indexedRelations[collectionName][fieldName]
+	return isIndexed
+}
+
+// Replaces the index rows of the record's field with its current relations
+func writeRelationIndex(record *core.Record, fieldName string, dao core.App) error {
+	collectionName := record.Collection().Name
+
+	if err := deleteRelationIndex(collectionName, fieldName, record.Id, dao); err != nil {
+		return err
+	}
+
+	for _, relationId := range record.GetStringSlice(fieldName) {
+		_, err := dao.DB().NewQuery(
+			"INSERT OR IGNORE INTO {{" + names.Tables.RelationIndex + "}} " +
+				"([[collectionName]], [[fieldName]], [[recordId]], [[relationId]]) " +
+				"VALUES ({:collectionName}, {:fieldName}, {:recordId}, {:relationId})",
+		).Bind(dbx.Params{
+			"collectionName": collectionName,
+			"fieldName":      fieldName,
+			"recordId":       record.Id,
+			"relationId":     relationId,
+		}).Execute()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Deletes the index rows of the record's field
+func deleteRelationIndex(collectionName string, fieldName string, recordId string, dao core.App) error {
+	_, err := dao.DB().Delete(names.Tables.RelationIndex, dbx.HashExp{
+		"collectionName": collectionName,
+		"fieldName":      fieldName,
+		"recordId":       recordId,
+	}).Execute()
+
+	return err
+}
+
+// Returns the expression that selects the records of the collection that hold
+// the relationId in the indexed field
+func relationIndexExp(relationId string, collectionName string, fieldName string) dbx.Expression {
+	return dbx.NewExp(
+		"[["+collectionName+".id]] IN (SELECT [[recordId]] FROM {{"+names.Tables.RelationIndex+"}} "+
+			"WHERE [[collectionName]] = {:collectionName} AND [[fieldName]] = {:fieldName} AND [[relationId]] = {:relationId})",
+		dbx.Params{
+			"collectionName": collectionName,
+			"fieldName":      fieldName,
+			"relationId":     relationId,
+		},
+	)
+}
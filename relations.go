@@ -2,53 +2,49 @@ package main
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
 )
 
-// Expands all relations that the schema of the records has
+// ExpandRelationPaths expands the relation paths of the records. A path is a chain
+// of relation field names that are joined by dots like "registrations.players".
 //
-// All records have to have the same schema e.g. be from the same collection
-func ExpandAllRelations(records []*core.Record, dao core.App) error {
-	if len(records) == 0 {
+// The relations are loaded level by level. Each relation field of a level is loaded with one
+// query for all records of the level. Records that hold the same relation share the related record.
+func ExpandRelationPaths(records []*core.Record, relationPaths []string, dao core.App) error {
+	if len(records) == 0 || len(relationPaths) == 0 {
 		return nil
 	}
-	var fields core.FieldsList = records[0].Collection().Fields
 
-	relationFields := make([]string, 0, len(fields))
+	// The relation fields of this level and the paths that continue below them
+	fieldNames := make([]string, 0, len(relationPaths))
+	subPaths := make(map[string][]string, len(relationPaths))
 
-	for _, field := range fields {
-		if _, ok := field.(*core.RelationField); ok {
-			relationFields = append(relationFields, field.GetName())
-		}
-	}
-
-	var error map[string]error = dao.ExpandRecords(records, relationFields, nil)
-
-	if len(error) > 0 {
-		return fmt.Errorf("expansion of all relation fields failed:\n%v", error)
-	}
-
-	return nil
-}
+	for _, path := range relationPaths {
+		fieldName, subPath, _ := strings.Cut(path, ".")
 
-// Expands all relations according to the schema of the records and
-// recursively does the same for the expanded relations
-func ExpandAllNestedRelations(records []*core.Record, dao core.App) error {
-	if len(records) == 0 {
-		return nil
+		if _, exists := subPaths[fieldName]; !exists {
+			fieldNames = append(fieldNames, fieldName)
+			subPaths[fieldName] = []string{}
+		}
+		if subPath != "" {
+			subPaths[fieldName] = append(subPaths[fieldName], subPath)
+		}
 	}
 
-	if err := ExpandAllRelations(records, dao); err != nil {
-		return err
-	}
+	for _, fieldName := range fieldNames {
+		if errs := dao.ExpandRecords(records, []string{fieldName}, nil); len(errs) != 0 {
+			return fmt.Errorf("expansion of the relation %s failed:\n%v", fieldName, errs)
+		}
 
-	relatedRecords := getAllUnexpandedRelations(records)
+		if len(subPaths[fieldName]) == 0 {
+			continue
+		}
 
-	for _, records := range relatedRecords {
-		if err := ExpandAllNestedRelations(records, dao); err != nil {
+		if err := ExpandRelationPaths(getExpandedRelations(records, fieldName), subPaths[fieldName], dao); err != nil {
 			return err
 		}
 	}
@@ -58,39 +54,41 @@ func ExpandAllNestedRelations(records []*core.Record, dao core.App) error {
 
 // RegisterRelationUpdateCascade reigsters a hook that cascades update events of related models
 // under the field name up to the models in the collection.
+//
+// The models are not saved. Instead their changes are published on the RelationChangesTopic
+// in one message per transaction after it has been committed.
 func RegisterRelationUpdateCascade(
 	collectionName string,
 	fieldName string,
 	app *pocketbase.PocketBase,
 ) error {
-	relationCollection, err := app.FindCollectionByNameOrId(collectionName)
+	relationField, relationGetter, err := findRelationField(collectionName, fieldName, app)
 	if err != nil {
 		return err
 	}
 
-	var relationGetter func(string, string, string, core.App) ([]*core.Record, error)
-
-	relationField := relationCollection.Fields.GetByName(fieldName).(*core.RelationField)
-
-	if relationField.IsMultiple() {
-		relationGetter = FindReverseMultiRelations
-	} else {
-		relationGetter = FindReverseRelations
+	relatedCollection, err := app.FindCollectionByNameOrId(relationField.CollectionId)
+	if err != nil {
+		return err
 	}
 
+	relationCascades[relatedCollection.Name] = append(relationCascades[relatedCollection.Name], relationCascade{
+		collectionName: collectionName,
+		fieldName:      fieldName,
+		findRelations:  relationGetter,
+	})
+
 	app.OnRecordUpdate(relationField.CollectionId).BindFunc(func(e *core.RecordEvent) error {
 		if err := e.Next(); err != nil {
 			return err
 		}
 
-		relations, err := relationGetter(e.Record.Id, collectionName, fieldName, app)
+		relations, err := relationGetter(e.Record.Id, collectionName, fieldName, e.App)
 		if err != nil {
 			return err
 		}
 
-		if err := CascadeRelationUpdate(relations, app); err != nil {
-			return err
-		}
+		addToCascadeBatch(e.Record, relations, fieldName, e.App)
 
 		return nil
 	})
@@ -98,44 +96,47 @@ func RegisterRelationUpdateCascade(
 	return nil
 }
 
-// Returns all the records that are related to the given records mapped by their collection.
-// The slices contain no duplicates even if the same record is in multiple relations.
-// Also the returned relations will not include records which already have their own relations
-// expanded to avoid circular expansions.
-func getAllUnexpandedRelations(records []*core.Record) map[string][]*core.Record {
-	allRelationsSet := make(map[*core.Record]struct{})
+// Returns the relation field of the collection under the field name and the function that finds
+// the records of the collection which hold a related record in the field
+func findRelationField(
+	collectionName string,
+	fieldName string,
+	dao core.App,
+) (*core.RelationField, func(string, string, string, core.App) ([]*core.Record, error), error) {
+	collection, err := dao.FindCollectionByNameOrId(collectionName)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	for _, record := range records {
-		relations := make([]*core.Record, 0, 3)
-
-		for _, relation := range record.Expand() {
-			switch r := relation.(type) {
-			case *core.Record:
-				relations = append(relations, r)
-			case []*core.Record:
-				relations = append(relations, r...)
-			}
-		}
+	relationField, isRelation := collection.Fields.GetByName(fieldName).(*core.RelationField)
+	if !isRelation {
+		return nil, nil, fmt.Errorf("%s.%s is not a relation field", collectionName, fieldName)
+	}
 
-		for _, relatedRecord := range relations {
-			if len(relatedRecord.Expand()) == 0 {
-				allRelationsSet[relatedRecord] = struct{}{}
-			}
-		}
+	if relationField.IsMultiple() {
+		return relationField, FindReverseMultiRelations, nil
 	}
 
-	allRelations := make(map[string][]*core.Record)
-	for relation := range allRelationsSet {
-		_, exists := allRelations[relation.Collection().Name]
-		if !exists {
-			allRelations[relation.Collection().Name] = make([]*core.Record, 0)
-		}
+	return relationField, FindReverseRelations, nil
+}
 
-		allRelations[relation.Collection().Name] = append(allRelations[relation.Collection().Name], relation)
-	}
+// Returns the records that are expanded under the field name of the given records.
+// Records that are related to more than one of the given records are only returned once.
+func getExpandedRelations(records []*core.Record, fieldName string) []*core.Record {
+	relations := make([]*core.Record, 0, len(records))
+	relationSet := make(map[*core.Record]struct{}, len(records))
 
-	return allRelations
+	for _, record := range records {
+		for _, relation := range record.ExpandedAll(fieldName) {
+			if _, exists := relationSet[relation]; exists {
+				continue
+			}
+			relationSet[relation] = struct{}{}
+			relations = append(relations, relation)
+		}
+	}
 
+	return relations
 }
 
 // FindReverseMultiRelations queries the DB for records from the relationCollection that have
@@ -161,6 +162,7 @@ func FindReverseRelations(
 
 // FindReverseMultiRelations queries the DB for records from the relationCollection that have
 // the relationId in their multi-relation under the relationFieldName.
+// Fields with a relation index are looked up in the index.
 func FindReverseMultiRelations(
 	relationId string,
 	relationCollectionName string,
@@ -169,6 +171,18 @@ func FindReverseMultiRelations(
 ) ([]*core.Record, error) {
 	var relatedRecords []*core.Record = make([]*core.Record, 0, 1)
 
+	if isRelationIndexed(relationCollectionName, relationFieldName) {
+		err := dao.RecordQuery(relationCollectionName).
+			AndWhere(relationIndexExp(relationId, relationCollectionName, relationFieldName)).
+			All(&relatedRecords)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return relatedRecords, nil
+	}
+
 	err := dao.RecordQuery(relationCollectionName).
 		AndWhere(
 			dbx.Exists(dbx.NewExp(
@@ -184,21 +198,3 @@ func FindReverseMultiRelations(
 
 	return relatedRecords, nil
 }
-
-// CascadeUpdate updated the relatedRecords without changing their data. These updates
-// trigger the realtime API update event to notify clients of the change in their
-// relation. Thus the update of the relation is cascaded to the related records.
-func CascadeRelationUpdate(
-	relatedRecords []*core.Record,
-	dao core.App,
-) error {
-	if len(relatedRecords) == 0 {
-		return nil
-	}
-
-	if err := ProcessAsModels(relatedRecords, dao.Save); err != nil {
-		return err
-	}
-
-	return nil
-}
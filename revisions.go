@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// The collections whose records have a revision mapped to the name of the revision field
+var revisionFields = map[string]string{
+	names.Collections.Competitions: names.Fields.Competitions.Revision,
+	names.Collections.MatchData:    names.Fields.MatchData.Revision,
+	names.Collections.Teams:        names.Fields.Teams.Revision,
+}
+
+// RegisterRevisionChecks registers the hooks that count up the revision of the records on
+// each update and reject the update and delete requests that expect another revision.
+//
+// The expected revision is given by the If-Match header. Requests without it are not checked.
+// The custom routes check the revision of the record that they change with checkRevision.
+func RegisterRevisionChecks(app *pocketbase.PocketBase) {
+	revisionCollections := make([]string, 0, len(revisionFields))
+	for collectionName := range revisionFields {
+		revisionCollections = append(revisionCollections, collectionName)
+	}
+
+	app.OnRecordCreate(revisionCollections...).BindFunc(func(e *core.RecordEvent) error {
+		// Restored records keep the revision that they had
+		if !isSnapshotRestore(e) {
+			e.Record.Set(revisionFields[e.Record.Collection().Name], 0)
+		}
+		return e.Next()
+	})
+
+	app.OnRecordUpdate(revisionCollections...).BindFunc(func(e *core.RecordEvent) error {
+		if isSnapshotRestore(e) {
+			return e.Next()
+		}
+
+		return runRecordEventInTransaction(e, func(txApp core.App) error {
+			// The original of the record is not refreshed when it is saved more than once
+			persistedRecord, err := txApp.FindRecordById(e.Record.Collection(), e.Record.Id)
+			if err != nil {
+				return err
+			}
+
+			fieldName := revisionFields[e.Record.Collection().Name]
+			e.Record.Set(fieldName, persistedRecord.GetInt(fieldName)+1)
+
+			return nil
+		}, nil)
+	})
+
+	checkRequestedRevision := func(e *core.RecordRequestEvent) error {
+		return runRequestInTransaction(e, func(txApp core.App) error {
+			persistedRecord, err := FetchRecord(e.Record.Collection().Name, e.Record.Id, txApp)
+			if err != nil {
+				return err
+			}
+
+			return checkRevision(e.RequestEvent, persistedRecord)
+		})
+	}
+
+	app.OnRecordUpdateRequest(revisionCollections...).BindFunc(checkRequestedRevision)
+	app.OnRecordDeleteRequest(revisionCollections...).BindFunc(checkRequestedRevision)
+}
+
+// Returns a REVISION_CONFLICT error when the request expects another revision of the record
+// than the one that it has. The record has to be read in the transaction of the change.
+func checkRevision(e *core.RequestEvent, record *core.Record) error {
+	ifMatch := strings.TrimSpace(e.Request.Header.Get("If-Match"))
+	if ifMatch == "" || ifMatch == "*" {
+		return nil
+	}
+
+	expectedRevision, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`))
+	if err != nil || expectedRevision < 0 {
+		return invalidFieldError("If-Match", "the revision has to be a non-negative whole number")
+	}
+
+	revision := record.GetInt(revisionFields[record.Collection().Name])
+	if revision == expectedRevision {
+		return nil
+	}
+
+	// The current state lets the client merge its change and try again
+	conflictErr := NewApiError(
+		http.StatusConflict,
+		ErrorCodeRevisionConflict,
+		"the record has been changed since revision "+strconv.Itoa(expectedRevision),
+	)
+	conflictErr.Result = record
+
+	return conflictErr
+}
@@ -6,13 +6,18 @@ var Collections = struct {
 	TournamentOrganizer    string
 	AgeGroups              string
 	Clubs                  string
+	CompetitionArchives    string
+	CompetitionTemplates   string
 	Competitions           string
 	Courts                 string
+	EventLog               string
 	Gymnasiums             string
 	MatchData              string
 	MatchSets              string
+	MergeLogs              string
 	Players                string
 	PlayingLevels          string
+	Snapshots              string
 	Teams                  string
 	TieBreakers            string
 	TournamentModeSettings string
@@ -21,13 +26,18 @@ var Collections = struct {
 	TournamentOrganizer:    "tournament_organizer",
 	AgeGroups:              "age_groups",
 	Clubs:                  "clubs",
+	CompetitionArchives:    "competition_archives",
+	CompetitionTemplates:   "competition_templates",
 	Competitions:           "competitions",
 	Courts:                 "courts",
+	EventLog:               "event_log",
 	Gymnasiums:             "gymnasiums",
 	MatchData:              "match_data",
 	MatchSets:              "match_sets",
+	MergeLogs:              "merge_logs",
 	Players:                "players",
 	PlayingLevels:          "playing_levels",
+	Snapshots:              "snapshots",
 	Teams:                  "teams",
 	TieBreakers:            "tie_breakers",
 	TournamentModeSettings: "tournament_mode_settings",
@@ -35,8 +45,25 @@ var Collections = struct {
 }
 
 var Fields = struct {
-	AgeGroups    struct{}
-	Clubs        struct{}
+	AgeGroups struct {
+		Age  string
+		Type string
+	}
+	Clubs struct {
+		Name string
+	}
+	CompetitionArchives struct {
+		Competition string
+		Matches     string
+		Draw        string
+		Seeds       string
+		StartTime   string
+		Created     string
+	}
+	CompetitionTemplates struct {
+		Name         string
+		Competitions string
+	}
 	Competitions struct {
 		AgeGroup               string
 		PlayingLevel           string
@@ -48,24 +75,61 @@ var Fields = struct {
 		TeamSize               string
 		Matches                string
 		TieBreakers            string
+		MaxEntries             string
+		Waitlist               string
+		Created                string
+		Revision               string
+	}
+	Courts   struct{ Gymnasium string }
+	EventLog struct {
+		Type       string
+		Collection string
+		Record     string
+		Data       string
+		Actor      string
+		Created    string
 	}
-	Courts     struct{ Gymnasium string }
 	Gymnasiums struct{}
 	MatchData  struct {
-		Court   string
-		Sets    string
-		EndTime string
+		Court     string
+		Sets      string
+		StartTime string
+		EndTime   string
+		Revision  string
 	}
 	MatchSets struct {
 		Team1Points string
 		Team2Points string
 	}
-	Players       struct{}
-	PlayingLevels struct{}
-	Teams         struct {
-		Players string
+	MergeLogs struct {
+		MergeTarget string
+		Report      string
+		Created     string
+	}
+	Players struct {
+		FirstName    string
+		LastName     string
+		Notes        string
+		Status       string
+		Club         string
+		Gender       string
+		PlayingLevel string
+		DateOfBirth  string
+	}
+	PlayingLevels struct {
+		Name  string
+		Index string
+	}
+	Snapshots struct {
+		Operation string
+		Content   string
+		Created   string
 	}
-	tieBreakers            struct{}
+	Teams struct {
+		Players  string
+		Revision string
+	}
+	TieBreakers            struct{ TieBreakerRanking string }
 	tournamentModeSettings struct{}
 	Tournaments            struct {
 		Title                 string
@@ -75,8 +139,43 @@ var Fields = struct {
 		PrintQrCodes          string
 		PlayerRestTime        string
 		QueueMode             string
+		MaxEntriesPerPlayer   string
 	}
 }{
+	AgeGroups: struct {
+		Age  string
+		Type string
+	}{
+		Age:  "age",
+		Type: "type",
+	},
+	Clubs: struct {
+		Name string
+	}{
+		Name: "name",
+	},
+	CompetitionArchives: struct {
+		Competition string
+		Matches     string
+		Draw        string
+		Seeds       string
+		StartTime   string
+		Created     string
+	}{
+		Competition: "competition",
+		Matches:     "matches",
+		Draw:        "draw",
+		Seeds:       "seeds",
+		StartTime:   "startTime",
+		Created:     "created",
+	},
+	CompetitionTemplates: struct {
+		Name         string
+		Competitions string
+	}{
+		Name:         "name",
+		Competitions: "competitions",
+	},
 	Competitions: struct {
 		AgeGroup               string
 		PlayingLevel           string
@@ -88,6 +187,10 @@ var Fields = struct {
 		TeamSize               string
 		Matches                string
 		TieBreakers            string
+		MaxEntries             string
+		Waitlist               string
+		Created                string
+		Revision               string
 	}{
 		AgeGroup:               "ageGroup",
 		PlayingLevel:           "playingLevel",
@@ -99,20 +202,43 @@ var Fields = struct {
 		TeamSize:               "teamSize",
 		Matches:                "matches",
 		TieBreakers:            "tieBreakers",
+		MaxEntries:             "maxEntries",
+		Waitlist:               "waitlist",
+		Created:                "created",
+		Revision:               "revision",
 	},
 	Courts: struct {
 		Gymnasium string
 	}{
 		Gymnasium: "gymnasium",
 	},
+	EventLog: struct {
+		Type       string
+		Collection string
+		Record     string
+		Data       string
+		Actor      string
+		Created    string
+	}{
+		Type:       "type",
+		Collection: "collection",
+		Record:     "record",
+		Data:       "data",
+		Actor:      "actor",
+		Created:    "created",
+	},
 	MatchData: struct {
-		Court   string
-		Sets    string
-		EndTime string
+		Court     string
+		Sets      string
+		StartTime string
+		EndTime   string
+		Revision  string
 	}{
-		Court:   "court",
-		Sets:    "sets",
-		EndTime: "endTime",
+		Court:     "court",
+		Sets:      "sets",
+		StartTime: "startTime",
+		EndTime:   "endTime",
+		Revision:  "revision",
 	},
 	MatchSets: struct {
 		Team1Points string
@@ -121,10 +247,59 @@ var Fields = struct {
 		Team1Points: "team1Points",
 		Team2Points: "team2Points",
 	},
+	MergeLogs: struct {
+		MergeTarget string
+		Report      string
+		Created     string
+	}{
+		MergeTarget: "mergeTarget",
+		Report:      "report",
+		Created:     "created",
+	},
+	Players: struct {
+		FirstName    string
+		LastName     string
+		Notes        string
+		Status       string
+		Club         string
+		Gender       string
+		PlayingLevel string
+		DateOfBirth  string
+	}{
+		FirstName:    "firstName",
+		LastName:     "lastName",
+		Notes:        "notes",
+		Status:       "status",
+		Club:         "club",
+		Gender:       "gender",
+		PlayingLevel: "playingLevel",
+		DateOfBirth:  "dateOfBirth",
+	},
+	PlayingLevels: struct {
+		Name  string
+		Index string
+	}{
+		Name:  "name",
+		Index: "index",
+	},
+	Snapshots: struct {
+		Operation string
+		Content   string
+		Created   string
+	}{
+		Operation: "operation",
+		Content:   "content",
+		Created:   "created",
+	},
 	Teams: struct {
-		Players string
+		Players  string
+		Revision string
 	}{
-		Players: "players",
+		Players:  "players",
+		Revision: "revision",
+	},
+	TieBreakers: struct{ TieBreakerRanking string }{
+		TieBreakerRanking: "tieBreakerRanking",
 	},
 	Tournaments: struct {
 		Title                 string
@@ -134,6 +309,7 @@ var Fields = struct {
 		PrintQrCodes          string
 		PlayerRestTime        string
 		QueueMode             string
+		MaxEntriesPerPlayer   string
 	}{
 		Title:                 "title",
 		UseAgeGroups:          "useAgeGroups",
@@ -142,5 +318,17 @@ var Fields = struct {
 		PrintQrCodes:          "printQrCodes",
 		PlayerRestTime:        "playerRestTime",
 		QueueMode:             "queueMode",
+		MaxEntriesPerPlayer:   "maxEntriesPerPlayer",
 	},
 }
+
+// Names of the plain tables that are not PB collections
+var Tables = struct {
+	RelationIndex string
+}{
+	RelationIndex: "relation_index",
+}
+
+// The type of the event log entries that hold the state of the records
+// when the event log was introduced. The event log migration writes them.
+const EventTypeInitialState = "initialState"
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+
+	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// The operations that capture a snapshot before they change anything
+const (
+	SnapshotOperationDeleteCategory        = "deleteCategory"
+	SnapshotOperationDisableCategorization = "disableCategorization"
+	SnapshotOperationCancelCompetition     = "cancelCompetition"
+)
+
+// The number of snapshots that are kept. The oldest snapshots are deleted when there are more.
+const maxSnapshots = 20
+
+// The order in which the records of a snapshot are restored so that
+// relations only point to records that have already been restored
+var snapshotRestoreOrder = []string{
+	names.Collections.AgeGroups,
+	names.Collections.PlayingLevels,
+	names.Collections.Tournaments,
+	names.Collections.MatchSets,
+	names.Collections.MatchData,
+	names.Collections.Teams,
+	names.Collections.Competitions,
+	names.Collections.CompetitionArchives,
+}
+
+// The key of the context value that marks the record events of a snapshot restore
+type snapshotRestoreKey struct{}
+
+// A record as it was when the snapshot was captured
+type SnapshotRecord struct {
+	Collection string
+	Data       map[string]any
+}
+
+type snapshotContent struct {
+	Records []SnapshotRecord
+
+	// The collections that have been captured completely. Records of these collections
+	// that did not exist when the snapshot was captured are deleted upon restore.
+	Scope []string
+}
+
+// PostUndo handles POST requests to the /api/ezbadminton/snapshots/undo route.
+// It restores the latest snapshot and deletes it. Undoing again restores the snapshot before.
+func PostUndo(e *core.RequestEvent, dao core.App) error {
+	snapshots := []*core.Record{}
+	err := dao.RecordQuery(names.Collections.Snapshots).
+		OrderBy(names.Fields.Snapshots.Created+" DESC", "rowid DESC").
+		Limit(1).
+		All(&snapshots)
+	if err != nil {
+		return RespondError(e, err)
+	}
+	if len(snapshots) == 0 {
+		return RespondError(e, NewApiError(http.StatusNotFound, ErrorCodeSnapshotNotFound, "there is nothing to undo"))
+	}
+
+	transactionError := dao.RunInTransaction(func(txDao core.App) error {
+		if err := RestoreSnapshot(snapshots[0], txDao); err != nil {
+			return err
+		}
+		return txDao.Delete(snapshots[0])
+	})
+
+	if transactionError != nil {
+		return RespondError(e, transactionError)
+	}
+
+	return e.NoContent(http.StatusOK)
+}
+
+// PostRestoreSnapshot handles POST requests to the /api/ezbadminton/snapshots/restore route.
+// It restores the given snapshot. The snapshot is kept.
+func PostRestoreSnapshot(e *core.RequestEvent, dao core.App) error {
+	body := struct {
+		Snapshot string
+	}{}
+
+	if err := e.BindBody(&body); err != nil {
+		return RespondError(e, invalidBodyError())
+	}
+	if body.Snapshot == "" {
+		return RespondError(e, missingFieldError("snapshot"))
+	}
+
+	snapshot, err := FetchRecord(names.Collections.Snapshots, body.Snapshot, dao)
+	if err != nil {
+		return RespondError(e, err)
+	}
+
+	if err := RestoreSnapshot(snapshot, dao); err != nil {
+		return RespondError(e, err)
+	}
+
+	return e.NoContent(http.StatusOK)
+}
+
+// CaptureSnapshot stores the current state of the given records so that they can be put back
+// by RestoreSnapshot. The records of the scope collections have to be given completely.
+func CaptureSnapshot(operation string, records []*core.Record, scope []string, dao core.App) error {
+	snapshotCollection, err := dao.FindCollectionByNameOrId(names.Collections.Snapshots)
+	if err != nil {
+		return err
+	}
+
+	content := snapshotContent{
+		Records: make([]SnapshotRecord, 0, len(records)),
+		Scope:   scope,
+	}
+	for _, record := range records {
+		content.Records = append(content.Records, SnapshotRecord{
+			Collection: record.Collection().Name,
+			Data:       record.FieldsData(),
+		})
+	}
+
+	snapshot := core.NewRecord(snapshotCollection)
+	snapshot.Set(names.Fields.Snapshots.Operation, operation)
+	snapshot.Set(names.Fields.Snapshots.Content, content)
+
+	if err := dao.Save(snapshot); err != nil {
+		return err
+	}
+
+	return pruneSnapshots(dao)
+}
+
+// Captures a snapshot of all competitions, teams, matches and sets together with the given records
+func captureCompetitionsSnapshot(operation string, dao core.App, records ...*core.Record) error {
+	scope := []string{
+		names.Collections.Competitions,
+		names.Collections.Teams,
+		names.Collections.MatchData,
+		names.Collections.MatchSets,
+	}
+
+	for _, collectionName := range scope {
+		collectionRecords, err := FetchCollection(collectionName, dao)
+		if err != nil {
+			return err
+		}
+		records = append(records, collectionRecords...)
+	}
+
+	return CaptureSnapshot(operation, records, scope, dao)
+}
+
+// RestoreSnapshot puts the records of the snapshot back into the state that they had when the
+// snapshot was captured. Deleted records are recreated with their original IDs.
+//
+// The records are saved without validation because they were valid when they were captured.
+// The hooks that react to changes of the tournament (see isSnapshotRestore) do not run for
+// the saves and deletions of the restore. The integrity hooks like the relation cleanups do.
+func RestoreSnapshot(snapshot *core.Record, dao core.App) error {
+	content := snapshotContent{}
+	if err := snapshot.UnmarshalJSONField(names.Fields.Snapshots.Content, &content); err != nil {
+		return err
+	}
+
+	restoreRank := func(collectionName string) int {
+		return slices.Index(snapshotRestoreOrder, collectionName)
+	}
+
+	slices.SortStableFunc(content.Records, func(a, b SnapshotRecord) int {
+		return restoreRank(a.Collection) - restoreRank(b.Collection)
+	})
+	// Records that are no longer part of the scope are deleted in reverse order
+	slices.SortFunc(content.Scope, func(a, b string) int {
+		return restoreRank(b) - restoreRank(a)
+	})
+
+	ctx := context.WithValue(context.Background(), snapshotRestoreKey{}, true)
+
+	return dao.RunInTransaction(func(txDao core.App) error {
+		restoredIds := make(map[string]struct{}, len(content.Records))
+
+		for _, snapshotRecord := range content.Records {
+			restoredId, err := restoreRecord(ctx, snapshotRecord, txDao)
+			if err != nil {
+				return err
+			}
+			restoredIds[restoredId] = struct{}{}
+		}
+
+		for _, collectionName := range content.Scope {
+			records, err := FetchCollection(collectionName, txDao)
+			if err != nil {
+				return err
+			}
+
+			for _, record := range records {
+				if _, restored := restoredIds[record.Id]; restored {
+					continue
+				}
+				if err := txDao.DeleteWithContext(ctx, record); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// Saves the record data of the snapshot. The record is created
+// with its original ID if it does not exist anymore.
+func restoreRecord(ctx context.Context, snapshotRecord SnapshotRecord, dao core.App) (string, error) {
+	id, isString := snapshotRecord.Data[core.FieldNameId].(string)
+	if !isString || id == "" {
+		return "", errors.New("the snapshot contains a record without an ID")
+	}
+
+	record, err := dao.FindRecordById(snapshotRecord.Collection, id)
+	if err != nil {
+		collection, err := dao.FindCollectionByNameOrId(snapshotRecord.Collection)
+		if err != nil {
+			return "", err
+		}
+		record = core.NewRecord(collection)
+	}
+
+	record.Load(snapshotRecord.Data)
+
+	if err := dao.SaveNoValidateWithContext(ctx, record); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// Returns wether the record event is a save or deletion of a snapshot restore.
+// The waitlist promotion, the revision count, the domain events and the removal of
+// emptied or orphaned records skip these events. The restored records are already
+// in the state that these hooks would have brought them to when they were captured.
+func isSnapshotRestore(e *core.RecordEvent) bool {
+	if e.Context == nil {
+		return false
+	}
+
+	restoring, _ := e.Context.Value(snapshotRestoreKey{}).(bool)
+	return restoring
+}
+
+// Deletes the oldest snapshots so that only maxSnapshots remain
+func pruneSnapshots(dao core.App) error {
+	snapshots := []*core.Record{}
+	err := dao.RecordQuery(names.Collections.Snapshots).
+		OrderBy(names.Fields.Snapshots.Created+" DESC", "rowid DESC").
+		All(&snapshots)
+	if err != nil {
+		return err
+	}
+
+	if len(snapshots) <= maxSnapshots {
+		return nil
+	}
+
+	return ProcessAsModels(snapshots[maxSnapshots:], dao.Delete)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A row of a spreadsheet
+type SpreadsheetRow struct {
+	// The number of the row in the sheet starting at 1
+	Number int
+	Cells  []string
+}
+
+// ReadSpreadsheet reads the rows of a CSV file or of the first sheet of an XLSX file.
+// The format is determined by the file name's extension.
+func ReadSpreadsheet(fileName string, data []byte) ([]SpreadsheetRow, error) {
+	switch strings.ToLower(path.Ext(fileName)) {
+	case ".csv":
+		return readCsv(data)
+	case ".xlsx":
+		return readXlsx(data)
+	}
+
+	return nil, fmt.Errorf("unsupported spreadsheet format %q", path.Ext(fileName))
+}
+
+// Reads a CSV file that is separated by commas or by semicolons
+// (as exported by spreadsheet programs in many european locales)
+func readCsv(data []byte) ([]SpreadsheetRow, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = ';'
+	}
+
+	rows := []SpreadsheetRow{}
+	for {
+		cells, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, SpreadsheetRow{Number: line, Cells: cells})
+	}
+
+	return rows, nil
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		RelationId string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		Id     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxRichText `xml:"si"`
+}
+
+type xlsxRichText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxRichText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+
+	var builder strings.Builder
+	for _, run := range t.Runs {
+		builder.WriteString(run.Text)
+	}
+	return builder.String()
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		// The number of the row. Empty rows are left out of the sheet.
+		Number int `xml:"r,attr"`
+		Cells  []struct {
+			Reference    string       `xml:"r,attr"`
+			Type         string       `xml:"t,attr"`
+			Value        string       `xml:"v"`
+			InlineString xlsxRichText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// Reads the first worksheet of an XLSX file. All cells are returned as their text
+// representation. Date cells are returned as the serial number that XLSX stores.
+func readXlsx(data []byte) ([]SpreadsheetRow, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	workbook := xlsxWorkbook{}
+	if err := readXlsxPart(archive, "xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, errors.New("the workbook has no sheets")
+	}
+
+	relationships := xlsxRelationships{}
+	if err := readXlsxPart(archive, "xl/_rels/workbook.xml.rels", &relationships); err != nil {
+		return nil, err
+	}
+
+	sheetPath := ""
+	for _, relationship := range relationships.Relationships {
+		if relationship.Id == workbook.Sheets[0].RelationId {
+			sheetPath = path.Join("xl", relationship.Target)
+			if strings.HasPrefix(relationship.Target, "/") {
+				sheetPath = strings.TrimPrefix(relationship.Target, "/")
+			}
+		}
+	}
+	if sheetPath == "" {
+		return nil, errors.New("the first sheet of the workbook could not be found")
+	}
+
+	// Workbooks without any text cells have no shared strings
+	sharedStrings := xlsxSharedStrings{}
+	if err := readXlsxPart(archive, "xl/sharedStrings.xml", &sharedStrings); err != nil && !errors.Is(err, errXlsxPartMissing) {
+		return nil, err
+	}
+
+	worksheet := xlsxWorksheet{}
+	if err := readXlsxPart(archive, sheetPath, &worksheet); err != nil {
+		return nil, err
+	}
+
+	rows := make([]SpreadsheetRow, 0, len(worksheet.Rows))
+
+	for i, xlsxRow := range worksheet.Rows {
+		// The number is optional and then counts on from the previous row
+		number := xlsxRow.Number
+		if number == 0 {
+			number = 1
+			if i > 0 {
+				number = rows[i-1].Number + 1
+			}
+		}
+
+		row := []string{}
+
+		for i, cell := range xlsxRow.Cells {
+			column := i
+			if cell.Reference != "" {
+				column = xlsxColumnIndex(cell.Reference)
+			}
+			if column < 0 || column >= xlsxMaxColumns {
+				return nil, fmt.Errorf("invalid cell reference %q", cell.Reference)
+			}
+
+			var value string
+			switch cell.Type {
+			case "s":
+				index, err := strconv.Atoi(cell.Value)
+				if err != nil || index < 0 || index >= len(sharedStrings.Items) {
+					return nil, fmt.Errorf("invalid shared string reference in cell %s", cell.Reference)
+				}
+				value = sharedStrings.Items[index].String()
+			case "inlineStr":
+				value = cell.InlineString.String()
+			default:
+				value = cell.Value
+			}
+
+			for len(row) <= column {
+				row = append(row, "")
+			}
+			row[column] = value
+		}
+
+		rows = append(rows, SpreadsheetRow{Number: number, Cells: row})
+	}
+
+	return rows, nil
+}
+
+var errXlsxPartMissing = errors.New("xlsx part is missing")
+
+func readXlsxPart(archive *zip.Reader, name string, dst any) error {
+	file, err := archive.Open(name)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errXlsxPartMissing, name)
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	return xml.Unmarshal(content, dst)
+}
+
+// The number of columns that an XLSX worksheet can have (A to XFD)
+const xlsxMaxColumns = 16384
+
+// Returns the zero-based column index of a cell reference like "AB12", "ab12" or "$AB$12".
+// A reference without a column returns -1.
+func xlsxColumnIndex(reference string) int {
+	column := 0
+	for _, char := range strings.ToUpper(strings.TrimPrefix(reference, "$")) {
+		if char < 'A' || char > 'Z' {
+			break
+		}
+		column = column*26 + int(char-'A'+1)
+	}
+	return column - 1
+}
+
+// ParseSpreadsheetDate parses the date formats that are commonly found in spreadsheets.
+// XLSX serial date numbers are supported as well.
+func ParseSpreadsheetDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	for _, layout := range []string{"2006-01-02", "2.1.2006"} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+
+	if serial, err := strconv.ParseFloat(value, 64); err == nil && serial > 0 {
+		// XLSX counts the days since 1899-12-30
+		excelEpoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+		return excelEpoch.AddDate(0, 0, int(serial)), nil
+	}
+
+	return time.Time{}, fmt.Errorf("%q is not a valid date", value)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"slices"
+	"testing"
+)
+
+// Creates an XLSX file with the sheet data and shared strings of its first worksheet
+func newTestXlsx(t *testing.T, sheetData string, sharedStrings ...string) []byte {
+	t.Helper()
+
+	sharedStringItems := ""
+	for _, sharedString := range sharedStrings {
+		sharedStringItems += "<si><t>" + sharedString + "</t></si>"
+	}
+
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+			`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			sharedStringItems + `</sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<sheetData>` + sheetData + `</sheetData></worksheet>`,
+	}
+
+	buffer := &bytes.Buffer{}
+	archive := zip.NewWriter(buffer)
+	for name, content := range parts {
+		file, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := file.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+func TestReadXlsxRowNumbers(t *testing.T) {
+	data := newTestXlsx(
+		t,
+		`<row r="1"><c r="A1" t="s"><v>0</v></c></row>`+
+			`<row r="4"><c r="b4" t="inlineStr"><is><t>Anna</t></is></c></row>`+
+			`<row><c r="$C$5"><v>12</v></c></row>`,
+		"Name",
+	)
+
+	rows, err := ReadSpreadsheet("players.xlsx", data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []SpreadsheetRow{
+		{Number: 1, Cells: []string{"Name"}},
+		{Number: 4, Cells: []string{"", "Anna"}},
+		{Number: 5, Cells: []string{"", "", "12"}},
+	}
+
+	if len(rows) != len(expected) {
+		t.Fatalf("expected %d rows, got %d", len(expected), len(rows))
+	}
+	for i, row := range rows {
+		if row.Number != expected[i].Number || !slices.Equal(row.Cells, expected[i].Cells) {
+			t.Fatalf("expected row %v, got %v", expected[i], row)
+		}
+	}
+}
+
+func TestReadXlsxMalformedSheet(t *testing.T) {
+	scenarios := []struct {
+		name      string
+		sheetData string
+	}{
+		{"negative shared string", `<row r="1"><c r="A1" t="s"><v>-1</v></c></row>`},
+		{"shared string out of range", `<row r="1"><c r="A1" t="s"><v>1</v></c></row>`},
+		{"shared string not a number", `<row r="1"><c r="A1" t="s"><v>x</v></c></row>`},
+		{"cell reference without column", `<row r="1"><c r="1"><v>1</v></c></row>`},
+		{"cell reference beyond the last column", `<row r="1"><c r="XFE1"><v>1</v></c></row>`},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			data := newTestXlsx(t, s.sheetData, "Name")
+
+			if _, err := ReadSpreadsheet("players.xlsx", data); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestReadCsvRowNumbers(t *testing.T) {
+	data := []byte("\ufeffname;club\nAnna Berg;\"TV\nNord\"\nJan Kern;SC\n")
+
+	rows, err := ReadSpreadsheet("players.csv", data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	numbers := []int{}
+	for _, row := range rows {
+		numbers = append(numbers, row.Number)
+	}
+
+	if expected := []int{1, 2, 4}; !slices.Equal(numbers, expected) {
+		t.Fatalf("expected the row numbers %v, got %v", expected, numbers)
+	}
+	if rows[1].Cells[1] != "TV\nNord" {
+		t.Fatalf("expected the quoted club, got %q", rows[1].Cells[1])
+	}
+}
+
+func TestParseImportRowsKeepsSheetRowNumbers(t *testing.T) {
+	table := []SpreadsheetRow{
+		{Number: 1, Cells: []string{"Name", "Club"}},
+		{Number: 3, Cells: []string{"Anna Berg", "TV Nord"}},
+		{Number: 4, Cells: []string{"", " "}},
+		{Number: 9, Cells: []string{"Jan Kern", ""}},
+	}
+
+	rows, err := parseImportRows(table)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+	if rows[0].Row != 3 || rows[1].Row != 9 {
+		t.Fatalf("expected the rows 3 and 9, got %d and %d", rows[0].Row, rows[1].Row)
+	}
+	if rows[1].FirstName != "Jan" || rows[1].LastName != "Kern" {
+		t.Fatalf("expected Jan Kern, got %s %s", rows[1].FirstName, rows[1].LastName)
+	}
+}
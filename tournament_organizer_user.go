@@ -1,7 +1,6 @@
 package main
 
 import (
-	"errors"
 	"net/http"
 
 	names "github.com/ezBadminton/ezBadmintonServer/schema_names"
@@ -16,7 +15,7 @@ func GetTournamentOrganizerExists(e *core.RequestEvent, dao core.App) error {
 	exists, err := tournamentOrganizerExists(dao)
 
 	if err != nil {
-		return e.NoContent(http.StatusInternalServerError)
+		return RespondError(e, err)
 	}
 
 	response := struct {
@@ -35,7 +34,7 @@ func HandleBeforeTournamentOrganizerCreate(dao core.App) error {
 	}
 
 	if exists {
-		return errors.New("cannot sign up more than one organizer")
+		return rejectedError(ErrorCodeOrganizerAlreadyExists, "cannot sign up more than one organizer")
 	}
 
 	return nil